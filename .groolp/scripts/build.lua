@@ -29,7 +29,7 @@ register_task("lint", "Run golangci-lint", function()
 		print("golangci-lint passed successfully!")
 	end
 	set_data("linted", true)
-end, { "clean" })
+end, { "clean" }, { isolated = true })
 
 -- Task: build
 -- Builds the project; depends on "clean".
@@ -55,7 +55,8 @@ register_task("build", "Compile the project source code", function()
 end, { "clean", "lint", "test" })
 
 -- Task: test
--- Runs unit tests; depends on "build".
+-- Runs unit tests; isolated and depending on "clean" only, so that it can
+-- run alongside "lint" with --jobs.
 register_task("test", "Run unit tests for the project", function()
 	local code, err = run_command("go test -v -race ./...")
 	if err then
@@ -65,4 +66,4 @@ register_task("test", "Run unit tests for the project", function()
 	else
 		print("All tests passed.")
 	end
-end, { "clean", "lint" })
+end, { "clean" }, { isolated = true })
@@ -1,8 +1,18 @@
 package cli
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"os/signal"
 	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -13,30 +23,344 @@ import (
 
 var taskManager *core.TaskManager
 
+var (
+	// defaultGroolpDir is the name of the .groolp directory given to Init()
+	defaultGroolpDir string
+	// groolpDir is the .groolp directory of the project in use
+	groolpDir  string
+	projectDir string
+)
+
+var (
+	runJobs       int
+	runForce      bool
+	runKeepGoing  bool
+	runDryRun     bool
+	runReport     string
+	runReportFile string
+)
+
 var (
 	watchPaths            []string
 	watchTask             string
 	watchDebounceDuration int64
+	watchInclude          []string
+	watchExclude          []string
+	watchOnChange         string
+)
+
+var planFormat string
+
+var graphFormat string
+
+var (
+	listJSON bool
+	listAll  bool
+)
+
+var (
+	initTemplate string
+	initForce    bool
 )
 
 // Init() initialises the CLI with a TaskManager instance.
-func Init(tm *core.TaskManager, groolpDir string) *cobra.Command {
+func Init(tm *core.TaskManager, dir string) *cobra.Command {
 	taskManager = tm
+	defaultGroolpDir = dir
+	groolpDir = dir
 	rootCmd := &cobra.Command{
 		Use:   "groolp",
 		Short: "Groolp is a Gulp-like task runner built in Go (Groolp = Groovy Gulp)",
+		// Errors are printed by the caller, which also picks the exit code
+		// from them; see ExitCode()
+		SilenceErrors: true,
+		SilenceUsage:  true,
 	}
+	rootCmd.PersistentFlags().StringVar(
+		&projectDir,
+		"project-dir", "",
+		"Project root directory (default: nearest parent directory "+
+			"containing "+dir+", or $"+GroolpDirEnv+")",
+	)
+
+	// init command
+	initCmd := &cobra.Command{
+		Use:   "init",
+		Short: "Create a groolp project in the current directory",
+		Long: "Create the .groolp directory with tasks.yaml and a scripts " +
+			"directory from a template. Available templates: " +
+			strings.Join(TemplateNames(), ", ") + ".",
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{annotationNoProject: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := initGroolpDir()
+			if err := InitProject(dir, initTemplate, initForce); err != nil {
+				return fmt.Errorf("failed to initialise project: %w", err)
+			}
+			rootCmd.Printf(
+				"Created %s from the %s template\n",
+				dir,
+				initTemplate,
+			)
+			return nil
+		},
+	}
+	initCmd.Flags().StringVarP(
+		&initTemplate,
+		"template", "t", DefaultTemplate,
+		"Project template ("+strings.Join(TemplateNames(), ", ")+")",
+	)
+	_ = initCmd.RegisterFlagCompletionFunc(
+		"template",
+		cobra.FixedCompletions(TemplateNames(), cobra.ShellCompDirectiveNoFileComp),
+	)
+	initCmd.Flags().BoolVarP(
+		&initForce,
+		"force", "f", false,
+		"Overwrite the files of an existing project with the template",
+	)
 
 	// run command
 	runCmd := &cobra.Command{
-		Use:   "run [task]",
-		Short: "Run a specified task",
-		Args:  cobra.MinimumNArgs(1),
-		Run: func(cmd *cobra.Command, args []string) {
-			taskName := args[0]
-			if err := taskManager.Run(taskName); err != nil {
-				rootCmd.Printf("Error running task '%s': %v\n", taskName, err)
+		Use:   "run [task...] [-- key=value...]",
+		Short: "Run the specified tasks",
+		Long: "Run the specified tasks and their dependencies. Several tasks " +
+			"run in the given order within one session, so shared " +
+			"dependencies run only once. Parameter values given after " +
+			"-- are passed to every task that declares the parameter. " +
+			"Without tasks, an interactive picker lists the available " +
+			"tasks to choose from.",
+		Args:              cobra.ArbitraryArgs,
+		ValidArgsFunction: completeRunArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var params map[string]string
+			if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+				var err error
+				if params, err = parseParams(args[dash:]); err != nil {
+					return &UsageError{Err: err}
+				}
+				args = args[:dash]
+			}
+			if len(args) == 0 {
+				task, err := pickTask(taskManager.ListTasks())
+				if err != nil {
+					return err
+				}
+				args = []string{task.Name}
 			}
+
+			if runDryRun {
+				plan, err := taskManager.Plan(args...)
+				if err != nil {
+					return err
+				}
+				// A dry run must fail wherever the run itself would be
+				// rejected before starting
+				err = taskManager.CheckParams(args, params)
+				if err != nil {
+					return err
+				}
+				return plan.WriteText(cmd.OutOrStdout())
+			}
+
+			// Interrupting groolp cancels the run, which kills the
+			// process groups of running shell actions
+			ctx, stop := signal.NotifyContext(
+				context.Background(),
+				os.Interrupt,
+				syscall.SIGTERM,
+			)
+			defer stop()
+
+			results, err := taskManager.RunContext(
+				ctx,
+				args,
+				core.RunOptions{
+					Jobs:      runJobs,
+					Force:     runForce,
+					KeepGoing: runKeepGoing,
+					Params:    params,
+					// Output is only captured for the report, as
+					// capturing it hides the terminal from tasks
+					CaptureOutput: runReport != "",
+				},
+			)
+			if runReport != "" {
+				if reportErr := writeReport(results, err); reportErr != nil {
+					err = errors.Join(
+						err,
+						fmt.Errorf("failed to write report: %w", reportErr),
+					)
+				}
+			}
+			printSummary(cmd.OutOrStdout(), results)
+			return err
+		},
+	}
+
+	runCmd.Flags().IntVarP(
+		&runJobs,
+		"jobs", "j", 1,
+		"Maximum number of independent tasks to run at the same time "+
+			"(their output is interleaved)",
+	)
+	runCmd.Flags().BoolVarP(
+		&runForce,
+		"force", "f", false,
+		"Run tasks even if their inputs are unchanged",
+	)
+	runCmd.Flags().BoolVarP(
+		&runKeepGoing,
+		"keep-going", "k", false,
+		"Keep running tasks that do not depend on a failed task",
+	)
+	runCmd.Flags().BoolVarP(
+		&runDryRun,
+		"dry-run", "n", false,
+		"Print the order in which tasks would run without running them",
+	)
+	runCmd.Flags().StringVar(
+		&runReport,
+		"report", "",
+		"Write a report of the run in the given format (json or junit)",
+	)
+	_ = runCmd.RegisterFlagCompletionFunc(
+		"report",
+		cobra.FixedCompletions(
+			[]string{core.ReportJSON, core.ReportJUnit},
+			cobra.ShellCompDirectiveNoFileComp,
+		),
+	)
+	runCmd.Flags().StringVar(
+		&runReportFile,
+		"report-file", "",
+		"File to write the report to (default groolp-report.json or groolp-report.xml)",
+	)
+
+	runCmd.PreRunE = func(cmd *cobra.Command, args []string) error {
+		if runReport != "" &&
+			runReport != core.ReportJSON &&
+			runReport != core.ReportJUnit {
+			return usageErrorf(
+				"invalid value for --report: %s; expected json or junit",
+				runReport,
+			)
+		}
+		return nil
+	}
+
+	// plan command
+	planCmd := &cobra.Command{
+		Use:               "plan [task...]",
+		Short:             "Show the execution plan of tasks without running them",
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: completeTaskNames,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			plan, err := taskManager.Plan(args...)
+			if err != nil {
+				return err
+			}
+			if planFormat == "json" {
+				return plan.WriteJSON(cmd.OutOrStdout())
+			}
+			return plan.WriteText(cmd.OutOrStdout())
+		},
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if planFormat != "text" && planFormat != "json" {
+				return usageErrorf(
+					"invalid value for --format: %s; expected text or json",
+					planFormat,
+				)
+			}
+			return nil
+		},
+	}
+	planCmd.Flags().StringVar(
+		&planFormat,
+		"format", "text",
+		"Output format (text or json)",
+	)
+	_ = planCmd.RegisterFlagCompletionFunc(
+		"format",
+		cobra.FixedCompletions(
+			[]string{"text", "json"},
+			cobra.ShellCompDirectiveNoFileComp,
+		),
+	)
+
+	// graph command
+	graphCmd := &cobra.Command{
+		Use:   "graph [task...]",
+		Short: "Print the task dependency graph",
+		Long: "Print the dependency graph of the given tasks, or of all tasks " +
+			"if none are given, as Graphviz DOT, Mermaid or JSON. Tasks " +
+			"are marked with the source they were defined in (yaml or lua).",
+		ValidArgsFunction: completeTaskNames,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			graph, err := taskManager.Graph(args...)
+			if err != nil {
+				return err
+			}
+			switch graphFormat {
+			case "mermaid":
+				return graph.WriteMermaid(cmd.OutOrStdout())
+			case "json":
+				return graph.WriteJSON(cmd.OutOrStdout())
+			}
+			return graph.WriteDOT(cmd.OutOrStdout())
+		},
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			switch graphFormat {
+			case "dot", "mermaid", "json":
+				return nil
+			}
+			return usageErrorf(
+				"invalid value for --format: %s; expected dot, mermaid or json",
+				graphFormat,
+			)
+		},
+	}
+	graphCmd.Flags().StringVar(
+		&graphFormat,
+		"format", "dot",
+		"Output format (dot, mermaid or json)",
+	)
+	_ = graphCmd.RegisterFlagCompletionFunc(
+		"format",
+		cobra.FixedCompletions(
+			[]string{"dot", "mermaid", "json"},
+			cobra.ShellCompDirectiveNoFileComp,
+		),
+	)
+
+	// validate command
+	validateCmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Check the task graph for errors",
+		Long: "Check all registered tasks for unknown dependencies, " +
+			"circular dependencies, duplicate and invalid names. Exits " +
+			"with a non-zero status if any problem is found.",
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{annotationLoadErrors: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := taskManager.Validate()
+			if err == nil {
+				rootCmd.Printf(
+					"All %d tasks are valid\n",
+					len(taskManager.ListTasks()),
+				)
+				return nil
+			}
+
+			var invalid *core.ValidationError
+			if !errors.As(err, &invalid) {
+				return err
+			}
+			rootCmd.PrintErrf("Found %d problems:\n", len(invalid.Problems))
+			for _, problem := range invalid.Problems {
+				rootCmd.PrintErrf("  - %s\n", problem)
+			}
+			return &core.ConfigError{Err: errors.New("task graph is invalid")}
 		},
 	}
 
@@ -44,12 +368,53 @@ func Init(tm *core.TaskManager, groolpDir string) *cobra.Command {
 	listCmd := &cobra.Command{
 		Use:   "list",
 		Short: "List all available tasks",
-		Run: func(cmd *cobra.Command, args []string) {
-			tasks := taskManager.ListTasks()
-			rootCmd.Println("Available tasks:")
-			for _, task := range tasks {
-				rootCmd.Printf("- %s: %s\n", task.Name, task.Description)
+		Long: "List the available tasks sorted by name, with their " +
+			"dependencies and the file they were defined in. Private " +
+			"tasks, whose names start with '_', are hidden unless --all " +
+			"is given.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var tasks []*core.Task
+			for _, task := range taskManager.ListTasks() {
+				if listAll || !isPrivateTask(task.Name) {
+					tasks = append(tasks, task)
+				}
+			}
+
+			if listJSON {
+				return writeTaskListJSON(cmd.OutOrStdout(), tasks)
 			}
+			printTaskList(cmd.OutOrStdout(), tasks)
+			return nil
+		},
+	}
+	listCmd.Flags().BoolVar(
+		&listJSON,
+		"json", false,
+		"Print the tasks as JSON",
+	)
+	listCmd.Flags().BoolVarP(
+		&listAll,
+		"all", "a", false,
+		"Include private tasks whose names start with '_'",
+	)
+
+	// describe command
+	describeCmd := &cobra.Command{
+		Use:               "describe [task]",
+		Short:             "Show the full details of a task",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeSingleTask,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			task := findTask(args[0])
+			if task == nil {
+				return &core.UnknownTaskError{
+					Name:        args[0],
+					Suggestions: taskManager.Suggest(args[0]),
+				}
+			}
+			printTaskDetails(cmd.OutOrStdout(), task)
+			return nil
 		},
 	}
 
@@ -57,36 +422,70 @@ func Init(tm *core.TaskManager, groolpDir string) *cobra.Command {
 	watchCmd := &cobra.Command{
 		Use:   "watch",
 		Short: "Watch files for changes and trigger tasks",
-		Run: func(cmd *cobra.Command, args []string) {
+		Long: "Watch files for changes and run a task when they change. " +
+			"Without --task, every task that declares watch patterns is " +
+			"watched, and only the tasks whose patterns match a change " +
+			"run, together in one run.",
+		RunE: func(cmd *cobra.Command, args []string) error {
 			if watchTask == "" {
-				rootCmd.Println("Specify a task to run on changes using --task")
-				return
+				return watchAll(cmd, tm)
+			}
+
+			task := findTask(watchTask)
+			if task == nil {
+				return &core.UnknownTaskError{
+					Name:        watchTask,
+					Suggestions: taskManager.Suggest(watchTask),
+				}
 			}
-			if len(watchPaths) == 0 {
-				rootCmd.Println("Specify paths to watch using --path")
-				return
+
+			// Only files matching --include, or else the task's own
+			// watch patterns, trigger the task. Unless paths were given
+			// explicitly, the directories the patterns cover are watched.
+			var patterns []string
+			if cmd.Flags().Changed("include") {
+				patterns = watchInclude
+			} else if !cmd.Flags().Changed("path") {
+				patterns = task.Watch
+			}
+			var paths []string
+			if cmd.Flags().Changed("path") || len(patterns) == 0 {
+				paths = watchPaths
+				if len(paths) == 0 {
+					return usageErrorf("specify paths to watch using --path")
+				}
 			}
 
-			w, err := watcher.NewWatcher(
+			rule := watcher.Rule{
+				Task:     watchTask,
+				Patterns: patterns,
+				Service:  task.Service,
+			}
+			w, err := watcher.NewMultiWatcher(
 				tm,
-				watchPaths,
-				watchTask,
+				paths,
+				[]watcher.Rule{rule},
 				time.Duration(watchDebounceDuration)*time.Millisecond,
+				watchOptions(),
 			)
 			if err != nil {
-				rootCmd.Printf("Error initialising watcher: %v\n", err)
-				return
+				return fmt.Errorf("failed to initialise watcher: %w", err)
 			}
-
-			w.Start()
+			return startWatcher(w)
 		},
 		PreRunE: func(cmd *cobra.Command, args []string) error {
 			if watchDebounceDuration < 500 {
-				return fmt.Errorf(
+				return usageErrorf(
 					"invalid value for --debounce: %d; minimum allowed is 500 milliseconds",
 					watchDebounceDuration,
 				)
 			}
+			if _, err := watcher.ParseOnChange(watchOnChange); err != nil {
+				return usageErrorf(
+					"invalid value for --on-change: %s; expected queue, restart or ignore",
+					watchOnChange,
+				)
+			}
 			return nil
 		},
 	}
@@ -98,13 +497,43 @@ func Init(tm *core.TaskManager, groolpDir string) *cobra.Command {
 	watchCmd.Flags().StringVarP(
 		&watchTask,
 		"task", "t", "",
-		"Task to run on changes",
+		"Task to run on changes (default: every task with watch patterns)",
+	)
+	_ = watchCmd.RegisterFlagCompletionFunc("task", completeTaskFlag)
+	watchCmd.Flags().StringArrayVar(
+		&watchInclude,
+		"include", nil,
+		"Only trigger the task for files matching this glob pattern "+
+			"(repeatable; ** matches any number of directories)",
+	)
+	watchCmd.Flags().StringArrayVar(
+		&watchExclude,
+		"exclude", nil,
+		"Never trigger the task for files matching this glob pattern "+
+			"(repeatable; .gitignore and .groolpignore are excluded too)",
 	)
 	watchCmd.Flags().Int64VarP(
 		&watchDebounceDuration,
 		"debounce", "d", 500,
 		"Debounce duration in milliseconds (has to be at least 500)",
 	)
+	watchCmd.Flags().StringVar(
+		&watchOnChange,
+		"on-change", string(watcher.OnChangeQueue),
+		"What to do with changes while triggered tasks are running: "+
+			"queue them for one follow-up run, restart the run, or ignore them",
+	)
+	_ = watchCmd.RegisterFlagCompletionFunc(
+		"on-change",
+		cobra.FixedCompletions(
+			[]string{
+				string(watcher.OnChangeQueue),
+				string(watcher.OnChangeRestart),
+				string(watcher.OnChangeIgnore),
+			},
+			cobra.ShellCompDirectiveNoFileComp,
+		),
+	)
 
 	scriptCmd := &cobra.Command{
 		Use:   "script",
@@ -115,18 +544,333 @@ func Init(tm *core.TaskManager, groolpDir string) *cobra.Command {
 		Use:   "install [url]",
 		Short: "Install a Lua script",
 		Args:  cobra.ExactArgs(1),
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			url := args[0]
 			scriptsDir := filepath.Join(groolpDir, "scripts")
 			if err := scripts.LuaInstaller.InstallScript(url, scriptsDir); err != nil {
-				rootCmd.Printf("Error installing script: %v\n", err)
-				return
+				return fmt.Errorf("failed to install script: %w", err)
 			}
 			rootCmd.Println("Script installed successfully!")
+			return nil
 		},
 	}
 	scriptCmd.AddCommand(scriptInstallCmd)
 
-	rootCmd.AddCommand(runCmd, listCmd, watchCmd, scriptCmd)
+	rootCmd.AddCommand(
+		initCmd,
+		runCmd,
+		planCmd,
+		graphCmd,
+		validateCmd,
+		listCmd,
+		describeCmd,
+		watchCmd,
+		scriptCmd,
+	)
+	markUsageErrors(rootCmd)
 	return rootCmd
 }
+
+// watchAll() watches the patterns of every task that declares some and
+// runs the tasks whose patterns match a change
+func watchAll(cmd *cobra.Command, tm *core.TaskManager) error {
+	var rules []watcher.Rule
+	for _, task := range tm.ListTasks() {
+		if len(task.Watch) > 0 {
+			rules = append(rules, watcher.Rule{
+				Task:     task.Name,
+				Patterns: task.Watch,
+				Service:  task.Service,
+			})
+		}
+	}
+	if len(rules) == 0 {
+		return usageErrorf(
+			"no task declares watch patterns; " +
+				"specify a task to run on changes using --task",
+		)
+	}
+
+	var paths []string
+	if cmd.Flags().Changed("path") {
+		paths = watchPaths
+	}
+	w, err := watcher.NewMultiWatcher(
+		tm,
+		paths,
+		rules,
+		time.Duration(watchDebounceDuration)*time.Millisecond,
+		watchOptions(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to initialise watcher: %w", err)
+	}
+	w.SetInclude(watchInclude)
+
+	for _, rule := range rules {
+		cmd.PrintErrf(
+			"Watching %s for task %s\n",
+			strings.Join(rule.Patterns, ", "),
+			rule.Task,
+		)
+	}
+	return startWatcher(w)
+}
+
+// watchOptions() returns the --exclude patterns and the project's ignore
+// files, to be applied before the watcher walks the tree
+func watchOptions() watcher.Options {
+	return watcher.Options{
+		Exclude:     watchExclude,
+		IgnoreFiles: watcher.IgnoreFiles,
+	}
+}
+
+// startWatcher() watches until the watcher is closed or groolp is
+// interrupted. Ctrl+C is the normal way to stop watching, so it is not an
+// error.
+func startWatcher(w *watcher.Watcher) error {
+	w.SetOnChange(watcher.OnChange(watchOnChange))
+
+	// Services run in process groups of their own, which do not receive
+	// the terminal's Ctrl+C, so the watcher has to stop them on exit
+	ctx, stop := signal.NotifyContext(
+		context.Background(),
+		os.Interrupt,
+		syscall.SIGTERM,
+	)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		_ = w.Close()
+	}()
+
+	w.Start()
+	return nil
+}
+
+// findTask() looks up a registered task by name
+func findTask(name string) *core.Task {
+	for _, task := range taskManager.ListTasks() {
+		if task.Name == name {
+			return task
+		}
+	}
+	return nil
+}
+
+// parseParams() parses key=value command line arguments
+func parseParams(args []string) (map[string]string, error) {
+	params := make(map[string]string, len(args))
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("expected key=value, got '%s'", arg)
+		}
+		if _, exists := params[key]; exists {
+			return nil, fmt.Errorf("parameter '%s' is given twice", key)
+		}
+		params[key] = value
+	}
+	return params, nil
+}
+
+// isPrivateTask() reports whether a task is hidden from `groolp list`
+func isPrivateTask(name string) bool {
+	return strings.HasPrefix(name, "_")
+}
+
+// taskSource() returns the name of the file a task was defined in
+func taskSource(task *core.Task) string {
+	if task.Source == "" {
+		return "-"
+	}
+	return filepath.Base(task.Source)
+}
+
+// printTaskList() prints one row per task with its description,
+// dependencies and source
+func printTaskList(out io.Writer, tasks []*core.Task) {
+	fmt.Fprintln(out, "Available tasks:")
+	if len(tasks) == 0 {
+		return
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  NAME\tDESCRIPTION\tDEPENDS ON\tSOURCE")
+	for _, task := range tasks {
+		deps := "-"
+		if len(task.Dependencies) > 0 {
+			deps = strings.Join(task.Dependencies, ", ")
+		}
+		fmt.Fprintf(
+			tw,
+			"  %s\t%s\t%s\t%s\n",
+			task.Name,
+			task.Description,
+			deps,
+			taskSource(task),
+		)
+	}
+	tw.Flush()
+}
+
+type jsonTask struct {
+	Name         string   `json:"name"`
+	Description  string   `json:"description"`
+	Dependencies []string `json:"dependencies"`
+	Source       string   `json:"source,omitempty"`
+	Private      bool     `json:"private,omitempty"`
+}
+
+// writeTaskListJSON() prints the tasks as a JSON array for editor and
+// shell integrations
+func writeTaskListJSON(out io.Writer, tasks []*core.Task) error {
+	list := make([]jsonTask, 0, len(tasks))
+	for _, task := range tasks {
+		deps := task.Dependencies
+		if deps == nil {
+			deps = []string{}
+		}
+		list = append(list, jsonTask{
+			Name:         task.Name,
+			Description:  task.Description,
+			Dependencies: deps,
+			Source:       task.Source,
+			Private:      isPrivateTask(task.Name),
+		})
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(list)
+}
+
+// printTaskDetails() prints every setting of a task, leaving out those
+// that are not set
+func printTaskDetails(out io.Writer, task *core.Task) {
+	tw := tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(tw, "%s:\t%s\n", name, value)
+		}
+	}
+
+	field("Task", task.Name)
+	field("Description", task.Description)
+	field("Source", task.Source)
+	field("Depends on", strings.Join(task.Dependencies, ", "))
+	field("Command", task.Command)
+	field("Script", task.Script)
+	field("Directory", task.Dir)
+	field("Env", formatEnv(task.Env))
+	field("Env files", strings.Join(task.EnvFiles, ", "))
+	field("Inputs", strings.Join(task.Inputs, ", "))
+	field("Outputs", strings.Join(task.Outputs, ", "))
+	field("Watch", strings.Join(task.Watch, ", "))
+	if task.Timeout > 0 {
+		field("Timeout", task.Timeout.String())
+	}
+	if task.Service {
+		field("Service", "yes")
+	}
+	if grace := task.EffectiveGracePeriod(); grace > 0 {
+		field("Grace period", grace.String())
+	}
+	if task.AllowFailure {
+		field("Allow failure", "yes")
+	}
+	if isPrivateTask(task.Name) {
+		field("Private", "yes")
+	}
+	tw.Flush()
+
+	if len(task.Params) == 0 {
+		return
+	}
+	fmt.Fprintln(out, "Parameters:")
+	for _, param := range task.Params {
+		var details []string
+		if param.Required {
+			details = append(details, "required")
+		}
+		if param.Default != "" {
+			details = append(details, "default: "+param.Default)
+		}
+		if len(param.Enum) > 0 {
+			details = append(
+				details,
+				"one of: "+strings.Join(param.Enum, ", "),
+			)
+		}
+
+		line := "  " + param.Name
+		if len(details) > 0 {
+			line += " (" + strings.Join(details, "; ") + ")"
+		}
+		if param.Description != "" {
+			line += " - " + param.Description
+		}
+		fmt.Fprintln(out, line)
+	}
+}
+
+// formatEnv() lists environment variables as KEY=value, sorted by name
+func formatEnv(env map[string]string) string {
+	vars := make([]string, 0, len(env))
+	for key, value := range env {
+		vars = append(vars, key+"="+value)
+	}
+	sort.Strings(vars)
+	return strings.Join(vars, ", ")
+}
+
+// writeReport() writes run results and the error the run returned to the
+// file selected by --report-file
+func writeReport(results []*core.RunResult, runErr error) error {
+	path := runReportFile
+	if path == "" {
+		path = "groolp-report.json"
+		if runReport == core.ReportJUnit {
+			path = "groolp-report.xml"
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return core.WriteReport(f, runReport, results, runErr)
+}
+
+// printSummary() prints one line per task of a run with its status and
+// duration
+func printSummary(out io.Writer, results []*core.RunResult) {
+	if len(results) == 0 {
+		return
+	}
+
+	fmt.Fprintln(out, "Summary:")
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, res := range results {
+		status := string(res.Status)
+		if res.AllowedFailure {
+			status += " (allowed)"
+		}
+		line := fmt.Sprintf("  %s\t%s", status, res.Task)
+		switch res.Status {
+		case core.StatusOK:
+			line += "\t" + res.Duration.Round(time.Millisecond).String()
+		case core.StatusFailed:
+			line += fmt.Sprintf(
+				"\t%s\texit code %d",
+				res.Duration.Round(time.Millisecond),
+				res.ExitCode,
+			)
+		}
+		fmt.Fprintln(tw, line)
+	}
+	tw.Flush()
+}
@@ -2,11 +2,16 @@ package cli
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ystepanoff/groolp/core"
 	"github.com/ystepanoff/groolp/scripts"
@@ -19,7 +24,7 @@ func TestRunCommand(t *testing.T) {
 	_ = tm.Register(&core.Task{
 		Name:        "test-task",
 		Description: "A test task",
-		Action: func() error {
+		Action: func(ctx context.Context) error {
 			executed = true
 			return nil
 		},
@@ -67,33 +72,33 @@ func TestListCommand(t *testing.T) {
 			t.Fatalf("Unexpected error: %v", err)
 		}
 
-		expectedOutput := "Available tasks:\n"
-		expectedOutputLines := make([]string, 0)
+		expectedNames := make([]string, 0)
 		seen := make(map[string]bool)
 		for _, task := range test {
 			if _, exists := seen[task]; !exists {
-				expectedOutputLines = append(
-					expectedOutputLines,
-					fmt.Sprintf("- %s: %s", task, task),
-				)
+				expectedNames = append(expectedNames, task)
 				seen[task] = true
 			}
 		}
-		sort.Strings(expectedOutputLines)
-		expectedOutput += strings.Join(expectedOutputLines, "\n")
-
-		actualOutputLines := strings.Split(buf.String(), "\n")
-		actualOutput := actualOutputLines[0]
-		actualOutputLines = actualOutputLines[1:]
-		sort.Strings(actualOutputLines)
-		actualOutput += strings.Join(actualOutputLines, "\n")
-
-		if actualOutput != expectedOutput {
-			t.Errorf(
-				"Expected output '%s', got '%s'",
-				expectedOutput,
-				buf.String(),
-			)
+		sort.Strings(expectedNames)
+
+		lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+		if len(lines) != len(expectedNames)+2 ||
+			lines[0] != "Available tasks:" ||
+			strings.Join(strings.Fields(lines[1]), " ") !=
+				"NAME DESCRIPTION DEPENDS ON SOURCE" {
+			t.Fatalf("Unexpected output '%s'", buf.String())
+		}
+		for i, name := range expectedNames {
+			expectedFields := []string{name, name, "-", "-"}
+			fields := strings.Fields(lines[i+2])
+			if strings.Join(fields, " ") != strings.Join(expectedFields, " ") {
+				t.Errorf(
+					"Expected row %v, got '%s'",
+					expectedFields,
+					lines[i+2],
+				)
+			}
 		}
 	}
 }
@@ -106,17 +111,14 @@ func TestWatchCommand(t *testing.T) {
 	rootCmd.SetOut(buf)
 	rootCmd.SetArgs([]string{"watch"})
 
-	if err := rootCmd.Execute(); err != nil {
-		t.Fatalf("Unexpected error: %v", err)
+	err := rootCmd.Execute()
+	expected := "no task declares watch patterns; " +
+		"specify a task to run on changes using --task"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("Expected error '%s', got: %v", expected, err)
 	}
-
-	expectedOutput := "Specify a task to run on changes using --task\n"
-	if buf.String() != expectedOutput {
-		t.Errorf(
-			"Expected output '%s', got '%s'",
-			expectedOutput,
-			buf.String(),
-		)
+	if code := ExitCode(err); code != ExitUsage {
+		t.Errorf("Expected exit code %d, got %d", ExitUsage, code)
 	}
 }
 
@@ -136,13 +138,12 @@ func TestRunCommand_UnknownTask(t *testing.T) {
 
 	var buf bytes.Buffer
 	rootCmd.SetOut(&buf)
-	if err := rootCmd.Execute(); err != nil {
-		t.Fatalf("Unexpected error: %v", err)
+	err := rootCmd.Execute()
+	if err == nil || err.Error() != "task 'nonexistent-task' not found" {
+		t.Fatalf("Expected error about unknown task, got: %v", err)
 	}
-
-	output := buf.String()
-	if !strings.Contains(output, "Error running task 'nonexistent-task'") {
-		t.Errorf("Expected error about unknown task, got: %s", output)
+	if code := ExitCode(err); code != ExitUnknownTask {
+		t.Errorf("Expected exit code %d, got %d", ExitUnknownTask, code)
 	}
 }
 
@@ -152,7 +153,7 @@ func TestRunCommand_TaskFailure(t *testing.T) {
 	_ = tm.Register(&core.Task{
 		Name:        "fail-task",
 		Description: "Always fails",
-		Action: func() error {
+		Action: func(ctx context.Context) error {
 			return errors.New("simulated failure")
 		},
 	})
@@ -162,31 +163,50 @@ func TestRunCommand_TaskFailure(t *testing.T) {
 	rootCmd.SetOut(&buf)
 	rootCmd.SetArgs([]string{"run", "fail-task"})
 
-	if err := rootCmd.Execute(); err != nil {
-		t.Fatalf("Unexpected error: %v", err)
+	err := rootCmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "simulated failure") {
+		t.Fatalf("Expected the task failure, got: %v", err)
 	}
-
-	output := buf.String()
-	if !strings.Contains(output, "simulated failure") {
-		t.Errorf("Expected failure message in output, got: %s", output)
+	if code := ExitCode(err); code != ExitFailure {
+		t.Errorf("Expected exit code %d, got %d", ExitFailure, code)
+	}
+	if !strings.Contains(buf.String(), "failed  fail-task") {
+		t.Errorf("Expected the failure in the summary, got: %s", buf.String())
 	}
 }
 
 func TestWatchCommand_NoPathSpecified(t *testing.T) {
 	tm := core.NewTaskManager()
+	_ = tm.Register(&core.Task{Name: "some-task"})
 	rootCmd := Init(tm, ".groolp")
 
 	var buf bytes.Buffer
 	rootCmd.SetOut(&buf)
 	rootCmd.SetArgs([]string{"watch", "--task", "some-task", "--path", ""})
 
-	if err := rootCmd.Execute(); err != nil {
-		t.Fatalf("Unexpected error: %v", err)
+	err := rootCmd.Execute()
+	expected := "specify paths to watch using --path"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("Expected error '%s', got: %v", expected, err)
 	}
+}
 
-	expected := "Specify paths to watch using --path\n"
-	if buf.String() != expected {
-		t.Errorf("Expected output '%s', got '%s'", expected, buf.String())
+func TestWatchCommand_UnknownTask(t *testing.T) {
+	tm := core.NewTaskManager()
+	_ = tm.Register(&core.Task{Name: "gen"})
+	rootCmd := Init(tm, ".groolp")
+
+	var buf bytes.Buffer
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"watch", "--task", "gne", "--path", "."})
+
+	err := rootCmd.Execute()
+	expected := "task 'gne' not found (did you mean 'gen'?)"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("Expected error '%s', got: %v", expected, err)
+	}
+	if code := ExitCode(err); code != ExitUnknownTask {
+		t.Errorf("Expected exit code %d, got %d", ExitUnknownTask, code)
 	}
 }
 
@@ -212,11 +232,34 @@ func TestWatchCommand_InvalidDebounce(t *testing.T) {
 	if !strings.Contains(err.Error(), "invalid value for --debounce: 400") {
 		t.Errorf("Expected invalid debounce error, got: %v", err)
 	}
+	if code := ExitCode(err); code != ExitUsage {
+		t.Errorf("Expected exit code %d, got %d", ExitUsage, code)
+	}
 }
 
-func TestWatchCommand_Success(t *testing.T) {
+func TestWatchCommand_InvalidOnChange(t *testing.T) {
 	tm := core.NewTaskManager()
 	rootCmd := Init(tm, ".groolp")
+	rootCmd.SetArgs([]string{
+		"watch",
+		"--task", "some-task",
+		"--on-change", "later",
+	})
+
+	err := rootCmd.Execute()
+	if err == nil ||
+		!strings.Contains(err.Error(), "invalid value for --on-change: later") {
+		t.Fatalf("Expected invalid on-change error, got: %v", err)
+	}
+	if code := ExitCode(err); code != ExitUsage {
+		t.Errorf("Expected exit code %d, got %d", ExitUsage, code)
+	}
+}
+
+func TestWatchCommand_MissingPath(t *testing.T) {
+	tm := core.NewTaskManager()
+	_ = tm.Register(&core.Task{Name: "some-task"})
+	rootCmd := Init(tm, ".groolp")
 
 	var buf bytes.Buffer
 	rootCmd.SetOut(&buf)
@@ -228,15 +271,11 @@ func TestWatchCommand_Success(t *testing.T) {
 		"--debounce", "500",
 	})
 
+	// The flags are accepted; only watching the missing directory fails
 	err := rootCmd.Execute()
-	if err != nil {
-		t.Fatalf("Expected no error, got: %v", err)
+	if err == nil || !strings.Contains(err.Error(), "failed to initialise watcher") {
+		t.Fatalf("Expected a watcher error, got: %v", err)
 	}
-
-	/*output := buf.String()
-	if len(output) == 0 {
-		// Probably fine; the watcher started with no messages.
-	}*/
 }
 
 func TestScriptInstallCommand_Success(t *testing.T) {
@@ -282,18 +321,14 @@ func TestScriptInstallCommand_Error(t *testing.T) {
 	rootCmd.SetArgs(
 		[]string{"script", "install", "https://example.com/broken.lua"},
 	)
-	if err := rootCmd.Execute(); err != nil {
-		t.Fatalf("Unexpected error: %v", err)
-	}
-
-	output := buf.String()
-	if !strings.Contains(
-		output,
-		"Error installing script: mock install error",
+	err := rootCmd.Execute()
+	if err == nil || !strings.Contains(
+		err.Error(),
+		"failed to install script: mock install error",
 	) {
 		t.Errorf(
-			"Expected error message about 'mock install error', got: %s",
-			output,
+			"Expected error message about 'mock install error', got: %v",
+			err,
 		)
 	}
 }
@@ -308,16 +343,12 @@ func TestScriptInstallCommand_NonLua(t *testing.T) {
 	rootCmd.SetArgs(
 		[]string{"script", "install", "https://example.com/invalid.txt"},
 	)
-	if err := rootCmd.Execute(); err != nil {
-		t.Fatalf("Unexpected error: %v", err)
-	}
-
-	output := buf.String()
-	if !strings.Contains(
-		output,
-		"Error installing script: refusing to install non-.lua file",
+	err := rootCmd.Execute()
+	if err == nil || !strings.Contains(
+		err.Error(),
+		"failed to install script: refusing to install non-.lua file",
 	) {
-		t.Errorf("Expected a refusal to install .txt message, got: %s", output)
+		t.Errorf("Expected a refusal to install .txt message, got: %v", err)
 	}
 }
 
@@ -336,7 +367,502 @@ func TestWatchCommand_DebounceBoundary(t *testing.T) {
 	})
 
 	err := rootCmd.Execute()
-	if err != nil {
+	if err != nil && strings.Contains(err.Error(), "--debounce") {
 		t.Fatalf("Expected no error at the boundary of 500ms, got: %v", err)
 	}
 }
+
+func TestRunCommand_Report(t *testing.T) {
+	tm := core.NewTaskManager()
+	_ = tm.Register(&core.Task{
+		Name:        "report-task",
+		Description: "A reported task",
+		Action: func(ctx context.Context) error {
+			fmt.Fprint(core.TaskStdout(ctx), "reported output")
+			return nil
+		},
+	})
+
+	reportFile := filepath.Join(t.TempDir(), "report.json")
+	rootCmd := Init(tm, ".groolp")
+	rootCmd.SetArgs([]string{
+		"run", "report-task",
+		"--report", "json",
+		"--report-file", reportFile,
+	})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(reportFile)
+	if err != nil {
+		t.Fatalf("Report was not written: %v", err)
+	}
+	if !strings.Contains(string(data), `"name": "report-task"`) ||
+		!strings.Contains(string(data), "reported output") {
+		t.Errorf("Unexpected report contents: %s", data)
+	}
+}
+
+func TestRunCommand_InvalidReportFormat(t *testing.T) {
+	tm := core.NewTaskManager()
+	rootCmd := Init(tm, ".groolp")
+	rootCmd.SetOut(new(bytes.Buffer))
+	rootCmd.SetArgs([]string{"run", "some-task", "--report", "yaml"})
+
+	err := rootCmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "invalid value for --report") {
+		t.Errorf("Expected invalid report format error, got: %v", err)
+	}
+}
+
+func TestRunCommand_MultipleTasks(t *testing.T) {
+	tm := core.NewTaskManager()
+
+	runs := make(map[string]int)
+	register := func(name string, deps ...string) {
+		_ = tm.Register(&core.Task{
+			Name:         name,
+			Dependencies: deps,
+			Action: func(ctx context.Context) error {
+				runs[name]++
+				return nil
+			},
+		})
+	}
+	register("clean")
+	register("lint", "clean")
+	register("test", "clean")
+
+	rootCmd := Init(tm, ".groolp")
+	var buf bytes.Buffer
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"run", "clean", "lint", "test"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, name := range []string{"clean", "lint", "test"} {
+		if runs[name] != 1 {
+			t.Errorf("Expected %s to run once, ran %d times", name, runs[name])
+		}
+	}
+
+	output := buf.String()
+	if !strings.HasPrefix(output, "Summary:\n") {
+		t.Fatalf("Expected a summary, got: %s", output)
+	}
+	for _, name := range []string{"clean", "lint", "test"} {
+		if !strings.Contains(output, "ok  "+name) {
+			t.Errorf("Expected %s in summary, got: %s", name, output)
+		}
+	}
+}
+
+func TestRunCommand_DryRun(t *testing.T) {
+	tm := core.NewTaskManager()
+
+	executed := false
+	_ = tm.Register(&core.Task{
+		Name: "build",
+		Action: func(ctx context.Context) error {
+			executed = true
+			return nil
+		},
+	})
+
+	rootCmd := Init(tm, ".groolp")
+	var buf bytes.Buffer
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"run", "--dry-run", "build"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if executed {
+		t.Errorf("Dry run must not execute the task")
+	}
+	expected := "Execution plan for build (1 tasks, 1 levels):\n  1. build\n"
+	if buf.String() != expected {
+		t.Errorf("Expected output '%s', got '%s'", expected, buf.String())
+	}
+}
+
+func TestRunCommand_DryRunChecksParams(t *testing.T) {
+	tm := core.NewTaskManager()
+	_ = tm.Register(&core.Task{
+		Name:   "deploy",
+		Params: []core.Param{{Name: "env", Required: true}},
+	})
+
+	rootCmd := Init(tm, ".groolp")
+	var buf bytes.Buffer
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"run", "--dry-run", "deploy"})
+
+	err := rootCmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "requires parameter 'env'") {
+		t.Fatalf("Expected the missing parameter, got: %v", err)
+	}
+	if code := ExitCode(err); code != ExitUsage {
+		t.Errorf("Expected exit code %d, got %d", ExitUsage, code)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Unexpected output '%s'", buf.String())
+	}
+}
+
+func TestPlanCommand_JSON(t *testing.T) {
+	tm := core.NewTaskManager()
+	_ = tm.Register(&core.Task{Name: "build"})
+
+	rootCmd := Init(tm, ".groolp")
+	var buf bytes.Buffer
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"plan", "build", "--format=json"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !strings.Contains(buf.String(), `"levels": [`) {
+		t.Errorf("Expected JSON plan, got: %s", buf.String())
+	}
+}
+
+func TestGraphCommand(t *testing.T) {
+	tm := core.NewTaskManager()
+	_ = tm.Register(&core.Task{Name: "clean"})
+	_ = tm.Register(&core.Task{
+		Name:         "build",
+		Dependencies: []string{"clean"},
+	})
+
+	rootCmd := Init(tm, ".groolp")
+	var buf bytes.Buffer
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"graph", "--format=mermaid"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := "flowchart LR\n" +
+		"  t0[\"build\"]\n" +
+		"  t1[\"clean\"]\n" +
+		"  t0 --> t1\n"
+	if buf.String() != expected {
+		t.Errorf("Expected output '%s', got '%s'", expected, buf.String())
+	}
+}
+
+func TestGraphCommand_InvalidFormat(t *testing.T) {
+	tm := core.NewTaskManager()
+
+	rootCmd := Init(tm, ".groolp")
+	rootCmd.SetOut(new(bytes.Buffer))
+	rootCmd.SetArgs([]string{"graph", "--format=png"})
+
+	err := rootCmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "invalid value for --format") {
+		t.Errorf("Expected invalid format error, got: %v", err)
+	}
+}
+
+func TestValidateCommand(t *testing.T) {
+	tm := core.NewTaskManager()
+	_ = tm.Register(&core.Task{
+		Name:         "build",
+		Dependencies: []string{"generate"},
+	})
+
+	rootCmd := Init(tm, ".groolp")
+	var buf bytes.Buffer
+	rootCmd.SetErr(&buf)
+	rootCmd.SetArgs([]string{"validate"})
+
+	err := rootCmd.Execute()
+	if err == nil {
+		t.Fatalf("Expected an error for an invalid task graph")
+	}
+	if code := ExitCode(err); code != ExitConfig {
+		t.Errorf("Expected exit code %d, got %d", ExitConfig, code)
+	}
+
+	expected := "Found 1 problems:\n" +
+		"  - task 'build' depends on unknown task 'generate'\n"
+	if buf.String() != expected {
+		t.Errorf("Expected output '%s', got '%s'", expected, buf.String())
+	}
+}
+
+func TestValidateCommand_Valid(t *testing.T) {
+	tm := core.NewTaskManager()
+	_ = tm.Register(&core.Task{Name: "build"})
+
+	rootCmd := Init(tm, ".groolp")
+	var buf bytes.Buffer
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"validate"})
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := "All 1 tasks are valid\n"
+	if buf.String() != expected {
+		t.Errorf("Expected output '%s', got '%s'", expected, buf.String())
+	}
+}
+
+func TestInitCommand(t *testing.T) {
+	tmpDir := t.TempDir()
+	groolpDir := filepath.Join(tmpDir, ".groolp")
+
+	tm := core.NewTaskManager()
+	rootCmd := Init(tm, groolpDir)
+	var buf bytes.Buffer
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"init", "--template", "node"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := fmt.Sprintf("Created %s from the node template\n", groolpDir)
+	if buf.String() != expected {
+		t.Errorf("Expected output '%s', got '%s'", expected, buf.String())
+	}
+	if _, err := os.Stat(filepath.Join(groolpDir, "tasks.yaml")); err != nil {
+		t.Errorf("tasks.yaml was not created: %v", err)
+	}
+}
+
+func TestNeedsProject(t *testing.T) {
+	tm := core.NewTaskManager()
+	rootCmd := Init(tm, ".groolp")
+
+	for args, expected := range map[string]bool{
+		"init":           false,
+		"run":            true,
+		"list":           true,
+		"script install": true,
+	} {
+		cmd, _, err := rootCmd.Find(strings.Fields(args))
+		if err != nil {
+			t.Fatalf("Command %s not found: %v", args, err)
+		}
+		if NeedsProject(cmd) != expected {
+			t.Errorf("NeedsProject(%s) = %v, expected %v", args, !expected, expected)
+		}
+	}
+}
+
+func TestRunCommand_Params(t *testing.T) {
+	tm := core.NewTaskManager()
+
+	var got map[string]string
+	_ = tm.Register(&core.Task{
+		Name:   "deploy",
+		Params: []core.Param{{Name: "env"}, {Name: "tag"}},
+		Action: func(ctx context.Context) error {
+			got = core.TaskParams(ctx)
+			return nil
+		},
+	})
+
+	rootCmd := Init(tm, ".groolp")
+	rootCmd.SetOut(new(bytes.Buffer))
+	rootCmd.SetArgs([]string{"run", "deploy", "--", "env=staging", "tag=a=b"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]string{"env": "staging", "tag": "a=b"}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("Expected params %v, got %v", expected, got)
+	}
+}
+
+func TestRunCommand_InvalidParams(t *testing.T) {
+	tm := core.NewTaskManager()
+	_ = tm.Register(&core.Task{Name: "deploy"})
+
+	rootCmd := Init(tm, ".groolp")
+	var buf bytes.Buffer
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"run", "deploy", "--", "staging"})
+	err := rootCmd.Execute()
+	expected := "expected key=value, got 'staging'"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("Expected error '%s', got: %v", expected, err)
+	}
+	if code := ExitCode(err); code != ExitUsage {
+		t.Errorf("Expected exit code %d, got %d", ExitUsage, code)
+	}
+}
+
+func TestListCommand_DepsSourceAndPrivate(t *testing.T) {
+	tm := core.NewTaskManager()
+	_ = tm.Register(&core.Task{
+		Name:        "build",
+		Description: "Build it",
+		Source:      ".groolp/tasks.yaml",
+	})
+	_ = tm.Register(&core.Task{
+		Name:         "deploy",
+		Description:  "Ship it",
+		Dependencies: []string{"build", "_sign"},
+		Source:       ".groolp/scripts/deploy.lua",
+	})
+	_ = tm.Register(&core.Task{Name: "_sign", Description: "Internal"})
+
+	rootCmd := Init(tm, ".groolp")
+	var buf bytes.Buffer
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"list"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := "Available tasks:\n" +
+		"  NAME    DESCRIPTION  DEPENDS ON    SOURCE\n" +
+		"  build   Build it     -             tasks.yaml\n" +
+		"  deploy  Ship it      build, _sign  deploy.lua\n"
+	if buf.String() != expected {
+		t.Errorf("Expected output '%s', got '%s'", expected, buf.String())
+	}
+
+	buf.Reset()
+	rootCmd.SetArgs([]string{"list", "--json", "--all"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var tasks []struct {
+		Name         string   `json:"name"`
+		Dependencies []string `json:"dependencies"`
+		Source       string   `json:"source"`
+		Private      bool     `json:"private"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &tasks); err != nil {
+		t.Fatalf("Invalid JSON output: %v", err)
+	}
+	if len(tasks) != 3 || tasks[0].Name != "_sign" || !tasks[0].Private {
+		t.Errorf("Expected private task _sign first, got %+v", tasks)
+	}
+	if tasks[2].Source != ".groolp/scripts/deploy.lua" ||
+		len(tasks[2].Dependencies) != 2 {
+		t.Errorf("Unexpected deploy entry: %+v", tasks[2])
+	}
+}
+
+func TestDescribeCommand(t *testing.T) {
+	tm := core.NewTaskManager()
+	_ = tm.Register(&core.Task{
+		Name:         "deploy",
+		Description:  "Ship it",
+		Dependencies: []string{"build"},
+		Source:       ".groolp/tasks.yaml",
+		Timeout:      5 * time.Minute,
+		Params: []core.Param{
+			{Name: "env", Required: true, Enum: []string{"staging", "prod"}},
+			{Name: "region", Default: "eu", Description: "Target region"},
+		},
+	})
+
+	rootCmd := Init(tm, ".groolp")
+	var buf bytes.Buffer
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"describe", "deploy"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := "Task:        deploy\n" +
+		"Description: Ship it\n" +
+		"Source:      .groolp/tasks.yaml\n" +
+		"Depends on:  build\n" +
+		"Timeout:     5m0s\n" +
+		"Parameters:\n" +
+		"  env (required; one of: staging, prod)\n" +
+		"  region (default: eu) - Target region\n"
+	if buf.String() != expected {
+		t.Errorf("Expected output '%s', got '%s'", expected, buf.String())
+	}
+
+	_ = tm.Register(&core.Task{
+		Name:     "dev",
+		Command:  "./build/server",
+		Script:   ".groolp/scripts/seed.lua",
+		Source:   ".groolp/tasks.yaml",
+		Env:      map[string]string{"PORT": "8080", "DEBUG": "1"},
+		EnvFiles: []string{"dev.env"},
+		Watch:    []string{"**/*.go"},
+		Service:  true,
+	})
+	buf.Reset()
+	rootCmd.SetArgs([]string{"describe", "dev"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected = "Task:         dev\n" +
+		"Source:       .groolp/tasks.yaml\n" +
+		"Command:      ./build/server\n" +
+		"Script:       .groolp/scripts/seed.lua\n" +
+		"Env:          DEBUG=1, PORT=8080\n" +
+		"Env files:    dev.env\n" +
+		"Watch:        **/*.go\n" +
+		"Service:      yes\n" +
+		"Grace period: 5s\n"
+	if buf.String() != expected {
+		t.Errorf("Expected output '%s', got '%s'", expected, buf.String())
+	}
+
+	buf.Reset()
+	rootCmd.SetArgs([]string{"describe", "missing"})
+	err := rootCmd.Execute()
+	if code := ExitCode(err); code != ExitUnknownTask {
+		t.Errorf("Expected exit code %d, got %d (%v)", ExitUnknownTask, code, err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Unexpected output '%s'", buf.String())
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tm := core.NewTaskManager()
+	_ = tm.Register(&core.Task{Name: "build"})
+
+	for _, tc := range []struct {
+		args     []string
+		expected int
+	}{
+		{[]string{"run", "build"}, ExitOK},
+		{[]string{"run"}, ExitUsage},
+		{[]string{"run", "build", "--no-such-flag"}, ExitUsage},
+		{[]string{"run", "build", "--", "env=prod"}, ExitUsage},
+		{[]string{"describe", "build", "extra"}, ExitUsage},
+		{[]string{"plan", "deploy"}, ExitUnknownTask},
+	} {
+		rootCmd := Init(tm, ".groolp")
+		rootCmd.SetOut(new(bytes.Buffer))
+		rootCmd.SetArgs(tc.args)
+		err := rootCmd.Execute()
+		if code := ExitCode(err); code != tc.expected {
+			t.Errorf(
+				"%v: expected exit code %d, got %d (%v)",
+				tc.args,
+				tc.expected,
+				code,
+				err,
+			)
+		}
+	}
+
+	interrupted := fmt.Errorf("run interrupted: %w", context.Canceled)
+	if code := ExitCode(interrupted); code != ExitInterrupted {
+		t.Errorf("Expected exit code %d, got %d", ExitInterrupted, code)
+	}
+	configErr := &core.ConfigError{File: "tasks.yaml", Err: errors.New("bad")}
+	if code := ExitCode(configErr); code != ExitConfig {
+		t.Errorf("Expected exit code %d, got %d", ExitConfig, code)
+	}
+}
@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// loadProjectForCompletion() loads the task registry while completing.
+// The hidden __complete command does not need a project, so the hook that
+// loads it is invoked here for the command being completed; outside of a
+// project there is simply nothing to suggest.
+func loadProjectForCompletion(cmd *cobra.Command) {
+	if root := cmd.Root(); root.PersistentPreRunE != nil {
+		_ = root.PersistentPreRunE(cmd, nil)
+	}
+}
+
+// completeTaskNames() suggests task names with their descriptions,
+// leaving out tasks already given as arguments. Private tasks are only
+// suggested once the user starts typing their leading '_'.
+func completeTaskNames(
+	cmd *cobra.Command,
+	args []string,
+	toComplete string,
+) ([]string, cobra.ShellCompDirective) {
+	loadProjectForCompletion(cmd)
+
+	given := make(map[string]bool, len(args))
+	for _, arg := range args {
+		given[arg] = true
+	}
+
+	var completions []string
+	for _, task := range taskManager.ListTasks() {
+		if given[task.Name] || !strings.HasPrefix(task.Name, toComplete) {
+			continue
+		}
+		if isPrivateTask(task.Name) && !strings.HasPrefix(toComplete, "_") {
+			continue
+		}
+		completions = append(completions, completion(task.Name, task.Description))
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeRunArgs() completes task names before `--` and the parameters
+// declared by the given tasks after it
+func completeRunArgs(
+	cmd *cobra.Command,
+	args []string,
+	toComplete string,
+) ([]string, cobra.ShellCompDirective) {
+	dash := cmd.ArgsLenAtDash()
+	if dash < 0 || !completingAfterDash() {
+		return completeTaskNames(cmd, args, toComplete)
+	}
+	if strings.Contains(toComplete, "=") {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	loadProjectForCompletion(cmd)
+
+	given := make(map[string]bool)
+	for _, arg := range args[dash:] {
+		key, _, _ := strings.Cut(arg, "=")
+		given[key] = true
+	}
+
+	descriptions := make(map[string]string)
+	for _, name := range args[:dash] {
+		task := findTask(name)
+		if task == nil {
+			continue
+		}
+		for _, param := range task.Params {
+			if !given[param.Name] && strings.HasPrefix(param.Name, toComplete) {
+				descriptions[param.Name] = param.Description
+			}
+		}
+	}
+
+	completions := make([]string, 0, len(descriptions))
+	for name, description := range descriptions {
+		completions = append(completions, completion(name+"=", description))
+	}
+	sort.Strings(completions)
+	return completions, cobra.ShellCompDirectiveNoFileComp |
+		cobra.ShellCompDirectiveNoSpace
+}
+
+// completingAfterDash() reports whether the word being completed follows
+// a `--`. ArgsLenAtDash() cannot tell while completing, since cobra parses
+// the flags once with an extra "--" appended and pflag keeps the position
+// from that parse, so the raw arguments are checked instead.
+func completingAfterDash() bool {
+	if len(os.Args) < 2 {
+		return false
+	}
+	for _, arg := range os.Args[1 : len(os.Args)-1] {
+		if arg == "--" {
+			return true
+		}
+	}
+	return false
+}
+
+// completeSingleTask() completes the only argument of commands that take
+// exactly one task
+func completeSingleTask(
+	cmd *cobra.Command,
+	args []string,
+	toComplete string,
+) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return completeTaskNames(cmd, args, toComplete)
+}
+
+// completeTaskFlag() completes flags that take a task name
+func completeTaskFlag(
+	cmd *cobra.Command,
+	args []string,
+	toComplete string,
+) ([]string, cobra.ShellCompDirective) {
+	return completeTaskNames(cmd, nil, toComplete)
+}
+
+// completion() formats a suggestion with its description the way cobra
+// expects it
+func completion(value, description string) string {
+	if description == "" {
+		return value
+	}
+	return value + "\t" + description
+}
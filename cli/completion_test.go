@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ystepanoff/groolp/core"
+)
+
+func completionTaskManager() *core.TaskManager {
+	tm := core.NewTaskManager()
+	_ = tm.Register(&core.Task{Name: "build", Description: "Build it"})
+	_ = tm.Register(&core.Task{Name: "bundle"})
+	_ = tm.Register(&core.Task{Name: "_internal"})
+	_ = tm.Register(&core.Task{
+		Name: "deploy",
+		Params: []core.Param{
+			{Name: "env", Description: "Target environment"},
+			{Name: "region"},
+		},
+	})
+	return tm
+}
+
+// complete() runs cobra's hidden completion command and returns the
+// suggestions it prints, without the trailing directive line
+func complete(t *testing.T, args ...string) []string {
+	t.Helper()
+	rootCmd := Init(completionTaskManager(), ".groolp")
+	var buf bytes.Buffer
+	rootCmd.SetOut(&buf)
+	rootCmd.SetErr(new(bytes.Buffer))
+	rootCmd.SetArgs(append([]string{"__complete"}, args...))
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	return lines[:len(lines)-1]
+}
+
+func TestCompletion_TaskNames(t *testing.T) {
+	for _, test := range []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"run", "b"}, []string{"build\tBuild it", "bundle"}},
+		{[]string{"run", "build", "b"}, []string{"bundle"}},
+		{[]string{"run", "_"}, []string{"_internal"}},
+		{[]string{"describe", "d"}, []string{"deploy"}},
+		{[]string{"describe", "deploy", ""}, []string{}},
+		{[]string{"watch", "--task", "bu"}, []string{"build\tBuild it", "bundle"}},
+		{[]string{"graph", "--format", ""}, []string{"dot", "mermaid", "json"}},
+	} {
+		got := complete(t, test.args...)
+		if strings.Join(got, "|") != strings.Join(test.expected, "|") {
+			t.Errorf(
+				"Completing %v: expected %q, got %q",
+				test.args,
+				test.expected,
+				got,
+			)
+		}
+	}
+}
+
+func TestCompletion_Params(t *testing.T) {
+	origArgs := os.Args
+	defer func() { os.Args = origArgs }()
+
+	args := []string{"run", "deploy", "--", "env=prod", ""}
+	os.Args = append([]string{"groolp", "__complete"}, args...)
+
+	got := complete(t, args...)
+	if strings.Join(got, "|") != "region=" {
+		t.Errorf("Expected only the remaining parameter, got %q", got)
+	}
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/ystepanoff/groolp/core"
+)
+
+// Exit codes of the groolp command
+const (
+	ExitOK = 0
+	// ExitFailure means a task failed, or another error occurred
+	ExitFailure = 1
+	// ExitUsage means invalid flags, arguments or task parameters
+	ExitUsage = 2
+	// ExitConfig means no project was found or its tasks are misconfigured
+	ExitConfig = 3
+	// ExitUnknownTask means a task given on the command line does not exist
+	ExitUnknownTask = 4
+	// ExitInterrupted means the run was interrupted, e.g. by Ctrl+C
+	ExitInterrupted = 130
+)
+
+// UsageError reports a command line that groolp does not accept
+type UsageError struct {
+	Err error
+}
+
+func (e *UsageError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *UsageError) Unwrap() error {
+	return e.Err
+}
+
+func usageErrorf(format string, a ...interface{}) error {
+	return &UsageError{Err: fmt.Errorf(format, a...)}
+}
+
+// ExitCode() returns the exit code groolp should exit with after err
+func ExitCode(err error) int {
+	var (
+		unknownErr *core.UnknownTaskError
+		configErr  *core.ConfigError
+		paramErr   *core.ParamError
+		usageErr   *UsageError
+	)
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, context.Canceled):
+		return ExitInterrupted
+	case errors.As(err, &unknownErr):
+		return ExitUnknownTask
+	case errors.As(err, &configErr):
+		return ExitConfig
+	case errors.As(err, &paramErr), errors.As(err, &usageErr):
+		return ExitUsage
+	}
+	return ExitFailure
+}
+
+// markUsageErrors() makes the flag and argument errors of cmd and its
+// subcommands usage errors
+func markUsageErrors(cmd *cobra.Command) {
+	cmd.SetFlagErrorFunc(func(c *cobra.Command, err error) error {
+		return &UsageError{Err: err}
+	})
+	if validate := cmd.Args; validate != nil {
+		cmd.Args = func(c *cobra.Command, args []string) error {
+			if err := validate(c, args); err != nil {
+				return &UsageError{Err: err}
+			}
+			return nil
+		}
+	}
+	for _, sub := range cmd.Commands() {
+		markUsageErrors(sub)
+	}
+}
@@ -4,50 +4,47 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 
+	"github.com/spf13/cobra"
 	"github.com/ystepanoff/groolp/core"
 )
 
-// InitGroolpDirectory() initialises ".groolp" directory if does not exist
-func InitGroolpDirectory(groolpDir string) error {
-	tasksConfig := filepath.Join(groolpDir, "tasks.yaml")
-	scriptsDir := filepath.Join(groolpDir, "scripts")
-	sampleScript := filepath.Join(scriptsDir, "sample.lua")
+// annotationNoProject marks commands that can run outside a groolp project
+const annotationNoProject = "groolp.noProject"
 
-	fi, err := os.Stat(groolpDir)
-	if err == nil {
-		if fi.IsDir() {
-			return nil
-		} else {
-			return fmt.Errorf("found .groolp file instead of a directory")
-		}
-	} else {
-		if !os.IsNotExist(err) {
-			return fmt.Errorf("failed to stat .groolp: %w", err)
-		}
-	}
+// annotationLoadErrors marks commands that report task definitions that
+// failed to load themselves, rather than failing before they run
+const annotationLoadErrors = "groolp.reportsLoadErrors"
 
-	fmt.Println("Initializing .groolp directory...")
-	if err := os.Mkdir(groolpDir, 0755); err != nil {
-		return fmt.Errorf("failed to create .groolp dir: %w", err)
-	}
+// DefaultTemplate is the project template used by `groolp init` when none
+// is given
+const DefaultTemplate = "sample"
 
-	sampleTasks := `# Sample tasks.yaml
+// projectGitignore keeps machine-local state in .groolp out of version
+// control
+const projectGitignore = `# Input hashes of this machine's last runs
+cache.json
+`
+
+// projectTemplate holds the files `groolp init` writes into .groolp
+type projectTemplate struct {
+	tasks string
+	// scripts maps file names in .groolp/scripts to their contents
+	scripts map[string]string
+}
+
+var projectTemplates = map[string]projectTemplate{
+	"sample": {
+		tasks: `# Sample tasks.yaml
 tasks:
   # This is a sample YAML-based task definition
   sample-yaml-task:
     description: "A sample task from tasks.yaml"
     action: "echo Hello from tasks.yaml!"
-`
-	if err := os.WriteFile(tasksConfig, []byte(sampleTasks), 0644); err != nil {
-		return fmt.Errorf("failed to write tasks.yaml: %w", err)
-	}
-
-	if err := os.Mkdir(scriptsDir, 0755); err != nil {
-		return fmt.Errorf("failed to create .groolp/scripts dir: %w", err)
-	}
-
-	sampleLua := `-- sample.lua
+`,
+		scripts: map[string]string{
+			"sample.lua": `-- sample.lua
 -- Register a sample plugin-based task in Lua
 
 register_task(
@@ -57,23 +54,197 @@ register_task(
     print("Hello from sample.lua!")
   end
 )
-`
-	if err := os.WriteFile(sampleScript, []byte(sampleLua), 0644); err != nil {
-		return fmt.Errorf("failed to write sample.lua: %w", err)
+`,
+		},
+	},
+	"go": {
+		tasks: `tasks:
+  lint:
+    description: "Vet the code"
+    command: go vet ./...
+    inputs: ["**/*.go", "go.mod", "go.sum"]
+
+  test:
+    description: "Run the tests"
+    command: go test ./...
+    inputs: ["**/*.go", "go.mod", "go.sum"]
+
+  build:
+    description: "Build the project"
+    command: go build ./...
+    depends: [lint, test]
+    watch: ["**/*.go", "go.mod", "go.sum"]
+`,
+	},
+	"node": {
+		tasks: `tasks:
+  install:
+    description: "Install dependencies"
+    command: npm install
+    inputs: [package.json, package-lock.json]
+    outputs: [node_modules]
+
+  lint:
+    description: "Lint the code"
+    command: npm run lint
+    depends: [install]
+
+  test:
+    description: "Run the tests"
+    command: npm test
+    depends: [install]
+
+  build:
+    description: "Build the project"
+    command: npm run build
+    depends: [lint, test]
+    watch: ["src/**/*"]
+`,
+	},
+	"python": {
+		tasks: `tasks:
+  install:
+    description: "Install dependencies"
+    command: python -m pip install -r requirements.txt
+    inputs: [requirements.txt]
+
+  lint:
+    description: "Lint the code"
+    command: python -m flake8 .
+    depends: [install]
+
+  test:
+    description: "Run the tests"
+    command: python -m pytest
+    depends: [install]
+    watch: ["**/*.py"]
+`,
+	},
+	"empty": {
+		tasks: `tasks: {}
+`,
+	},
+}
+
+// TemplateNames() returns the names of the available project templates
+func TemplateNames() []string {
+	names := make([]string, 0, len(projectTemplates))
+	for name := range projectTemplates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// InitProject() creates the ".groolp" directory from the given template,
+// along with a .gitignore for the task cache. An existing project is left
+// untouched unless force is set, in which case the template files
+// overwrite their existing counterparts; other files, such as installed
+// scripts, persistent data and the .gitignore, are kept.
+func InitProject(groolpDir, template string, force bool) error {
+	tmpl, ok := projectTemplates[template]
+	if !ok {
+		return fmt.Errorf(
+			"unknown template '%s' (available: %v)",
+			template,
+			TemplateNames(),
+		)
+	}
+
+	fi, err := os.Stat(groolpDir)
+	if err == nil {
+		if !fi.IsDir() {
+			return fmt.Errorf("found %s file instead of a directory", groolpDir)
+		}
+		if !force {
+			return fmt.Errorf(
+				"%s already exists; use --force to overwrite it",
+				groolpDir,
+			)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to stat %s: %w", groolpDir, err)
+	}
+
+	scriptsDir := filepath.Join(groolpDir, "scripts")
+	if err := os.MkdirAll(scriptsDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s dir: %w", scriptsDir, err)
+	}
+
+	tasksConfig := filepath.Join(groolpDir, "tasks.yaml")
+	if err := os.WriteFile(tasksConfig, []byte(tmpl.tasks), 0644); err != nil {
+		return fmt.Errorf("failed to write tasks.yaml: %w", err)
+	}
+
+	for name, content := range tmpl.scripts {
+		path := filepath.Join(scriptsDir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+
+	// An existing .gitignore may have been extended by the user
+	gitignore := filepath.Join(groolpDir, ".gitignore")
+	if _, err := os.Stat(gitignore); os.IsNotExist(err) {
+		err := os.WriteFile(gitignore, []byte(projectGitignore), 0644)
+		if err != nil {
+			return fmt.Errorf("failed to write .gitignore: %w", err)
+		}
 	}
+	return nil
+}
 
-	fmt.Println(
-		"Created .groolp directory with sample tasks.yaml and scripts/sample.lua",
-	)
+// RequireProject() returns an error if there is no groolp project in
+// groolpDir
+func RequireProject(groolpDir string) error {
+	fi, err := os.Stat(groolpDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf(
+				"no groolp project found (missing %s); run 'groolp init' to create one",
+				groolpDir,
+			)
+		}
+		return fmt.Errorf("failed to stat %s: %w", groolpDir, err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("found %s file instead of a directory", groolpDir)
+	}
 	return nil
 }
 
+// NeedsProject() reports whether cmd requires a groolp project, i.e. its
+// tasks, to run. Commands like init, help and shell completion do not;
+// completing task names loads the project on demand instead.
+func NeedsProject(cmd *cobra.Command) bool {
+	for c := cmd; c != nil; c = c.Parent() {
+		if c.Annotations[annotationNoProject] != "" {
+			return false
+		}
+		switch c.Name() {
+		case "help",
+			"completion",
+			cobra.ShellCompRequestCmd,
+			cobra.ShellCompNoDescRequestCmd:
+			return false
+		}
+	}
+	return true
+}
+
+// ReportsLoadErrors() reports whether cmd lists the Lua scripts that
+// failed to load itself, as validate does, so that a broken script must
+// not keep it from running
+func ReportsLoadErrors(cmd *cobra.Command) bool {
+	return cmd.Annotations[annotationLoadErrors] != ""
+}
+
 // InitTasksConfig() loading simple tasks from tasks config
 func InitTasksConfig(groolpDir string) (*core.TasksConfig, error) {
 	tasksConfig := filepath.Join(groolpDir, "tasks.yaml")
 	config, err := core.LoadConfig(tasksConfig)
 	if err != nil {
-		return nil, fmt.Errorf("error loading tasks config: %v", err)
+		return nil, fmt.Errorf("error loading tasks config: %w", err)
 	}
 	return config, nil
 }
@@ -8,24 +8,26 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/ystepanoff/groolp/cli"
+	"github.com/ystepanoff/groolp/core"
 )
 
-func TestInitGroolpDirectory_AlreadyExistsDirectory(t *testing.T) {
+func TestInitProject_AlreadyExistsDirectory(t *testing.T) {
 	tmpDir := t.TempDir()
 	groolpDir := filepath.Join(tmpDir, ".groolp")
 
 	err := os.Mkdir(groolpDir, 0755)
 	require.NoError(t, err, "failed to create .groolp directory")
 
-	err = cli.InitGroolpDirectory(groolpDir)
-	require.NoError(
+	err = cli.InitProject(groolpDir, cli.DefaultTemplate, false)
+	require.Error(
 		t,
 		err,
-		"InitGroolpDirectory should not fail if directory already exists",
+		"InitProject should not overwrite an existing directory",
 	)
+	require.Contains(t, err.Error(), "already exists")
 }
 
-func TestInitGroolpDirectory_AlreadyExistsFile(t *testing.T) {
+func TestInitProject_AlreadyExistsFile(t *testing.T) {
 	tmpDir := t.TempDir()
 	groolpFile := filepath.Join(tmpDir, ".groolp")
 
@@ -33,7 +35,7 @@ func TestInitGroolpDirectory_AlreadyExistsFile(t *testing.T) {
 	require.NoError(t, err, "failed to create .groolp file")
 	f.Close()
 
-	err = cli.InitGroolpDirectory(groolpFile)
+	err = cli.InitProject(groolpFile, cli.DefaultTemplate, true)
 	require.Error(
 		t,
 		err,
@@ -41,15 +43,15 @@ func TestInitGroolpDirectory_AlreadyExistsFile(t *testing.T) {
 	)
 }
 
-func TestInitGroolpDirectory_Success(t *testing.T) {
+func TestInitProject_Success(t *testing.T) {
 	tmpDir := t.TempDir()
 	groolpDir := filepath.Join(tmpDir, ".groolp")
 
-	err := cli.InitGroolpDirectory(groolpDir)
+	err := cli.InitProject(groolpDir, cli.DefaultTemplate, false)
 	require.NoError(
 		t,
 		err,
-		"InitGroolpDirectory should succeed on fresh directory",
+		"InitProject should succeed on fresh directory",
 	)
 
 	tasksPath := filepath.Join(groolpDir, "tasks.yaml")
@@ -72,7 +74,7 @@ func TestInitTasksConfig_Success(t *testing.T) {
 	tmpDir := t.TempDir()
 	groolpDir := filepath.Join(tmpDir, ".groolp")
 
-	err := cli.InitGroolpDirectory(groolpDir)
+	err := cli.InitProject(groolpDir, cli.DefaultTemplate, false)
 	require.NoError(t, err, "should successfully initialize .groolp dir")
 
 	config, err := cli.InitTasksConfig(groolpDir)
@@ -108,7 +110,7 @@ func TestInitTasksConfig_VerifySampleTaskDefinition(t *testing.T) {
 	tmpDir := t.TempDir()
 	groolpDir := filepath.Join(tmpDir, ".groolp")
 
-	err := cli.InitGroolpDirectory(groolpDir)
+	err := cli.InitProject(groolpDir, cli.DefaultTemplate, false)
 	require.NoError(t, err)
 
 	config, err := cli.InitTasksConfig(groolpDir)
@@ -130,3 +132,71 @@ func TestInitTasksConfig_VerifySampleTaskDefinition(t *testing.T) {
 		"mismatch in sample task description",
 	)
 }
+
+func TestInitProject_Templates(t *testing.T) {
+	for _, template := range cli.TemplateNames() {
+		t.Run(template, func(t *testing.T) {
+			groolpDir := filepath.Join(t.TempDir(), ".groolp")
+			require.NoError(t, cli.InitProject(groolpDir, template, false))
+
+			config, err := cli.InitTasksConfig(groolpDir)
+			require.NoError(t, err, "template tasks.yaml should load")
+
+			tm := core.NewTaskManager()
+			require.NoError(t, tm.RegisterFromConfig(config))
+			require.NoError(t, tm.Validate())
+
+			info, err := os.Stat(filepath.Join(groolpDir, "scripts"))
+			require.NoError(t, err, "scripts directory should be created")
+			require.True(t, info.IsDir())
+
+			gitignore, err := os.ReadFile(filepath.Join(groolpDir, ".gitignore"))
+			require.NoError(t, err, ".gitignore should be created")
+			require.Contains(t, string(gitignore), "\ncache.json\n")
+		})
+	}
+}
+
+func TestInitProject_UnknownTemplate(t *testing.T) {
+	groolpDir := filepath.Join(t.TempDir(), ".groolp")
+
+	err := cli.InitProject(groolpDir, "cobol", false)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unknown template 'cobol'")
+	require.NoDirExists(t, groolpDir)
+}
+
+func TestInitProject_Force(t *testing.T) {
+	groolpDir := filepath.Join(t.TempDir(), ".groolp")
+	require.NoError(t, cli.InitProject(groolpDir, "sample", false))
+
+	dataPath := filepath.Join(groolpDir, "data.json")
+	require.NoError(t, os.WriteFile(dataPath, []byte("{}"), 0644))
+	gitignorePath := filepath.Join(groolpDir, ".gitignore")
+	require.NoError(t, os.WriteFile(gitignorePath, []byte("data.json\n"), 0644))
+
+	err := cli.InitProject(groolpDir, "go", false)
+	require.Error(t, err, "existing project must not be overwritten")
+	require.Contains(t, err.Error(), "--force")
+
+	require.NoError(t, cli.InitProject(groolpDir, "go", true))
+	config, err := cli.InitTasksConfig(groolpDir)
+	require.NoError(t, err)
+	require.Contains(t, config.Tasks, "build")
+	require.NotContains(t, config.Tasks, "sample-yaml-task")
+	require.FileExists(t, dataPath, "other project files should be kept")
+	gitignore, err := os.ReadFile(gitignorePath)
+	require.NoError(t, err)
+	require.Equal(t, "data.json\n", string(gitignore))
+}
+
+func TestRequireProject(t *testing.T) {
+	groolpDir := filepath.Join(t.TempDir(), ".groolp")
+
+	err := cli.RequireProject(groolpDir)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "groolp init")
+
+	require.NoError(t, cli.InitProject(groolpDir, cli.DefaultTemplate, false))
+	require.NoError(t, cli.RequireProject(groolpDir))
+}
@@ -0,0 +1,252 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/ystepanoff/groolp/core"
+	"golang.org/x/term"
+)
+
+// pickerRows is the number of tasks the picker shows at once
+const pickerRows = 10
+
+var errNoTaskSelected = errors.New("no task selected")
+
+// pickTask lets the user choose one of tasks interactively. It is a
+// variable so that tests can replace the terminal UI.
+var pickTask = pickTaskFromTerminal
+
+// pickTaskFromTerminal() shows the task picker on the terminal. The picker
+// is drawn on stderr so that stdout only carries the output of the run.
+func pickTaskFromTerminal(tasks []*core.Task) (*core.Task, error) {
+	in, out := int(os.Stdin.Fd()), int(os.Stderr.Fd())
+	if !term.IsTerminal(in) || !term.IsTerminal(out) {
+		return nil, usageErrorf(
+			"specify at least one task to run " +
+				"(the interactive task picker needs a terminal)",
+		)
+	}
+
+	width, _, err := term.GetSize(out)
+	if err != nil {
+		width = 80
+	}
+	state, err := term.MakeRaw(in)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open task picker: %w", err)
+	}
+	defer term.Restore(in, state)
+
+	return newPicker(tasks, width).run(os.Stdin, os.Stderr)
+}
+
+// picker is a terminal UI that filters tasks as the user types and lets
+// them choose one with the arrow keys
+type picker struct {
+	tasks   []*core.Task
+	width   int
+	query   []rune
+	matches []*core.Task
+	// cursor is the index of the highlighted match, offset the index of
+	// the first match shown
+	cursor int
+	offset int
+	// drawn is the number of lines drawn last time, to be cleared before
+	// the next frame
+	drawn int
+}
+
+func newPicker(tasks []*core.Task, width int) *picker {
+	p := &picker{tasks: tasks, width: width}
+	p.filter()
+	return p
+}
+
+// filter() keeps the tasks whose name or description contains every word
+// of the query, ignoring case. Private tasks only show up once the query
+// starts with their leading '_'.
+func (p *picker) filter() {
+	query := string(p.query)
+	words := strings.Fields(strings.ToLower(query))
+
+	p.matches = p.matches[:0]
+	for _, task := range p.tasks {
+		if isPrivateTask(task.Name) && !strings.HasPrefix(query, "_") {
+			continue
+		}
+		text := strings.ToLower(task.Name + " " + task.Description)
+		matched := true
+		for _, word := range words {
+			if !strings.Contains(text, word) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			p.matches = append(p.matches, task)
+		}
+	}
+	p.cursor, p.offset = 0, 0
+}
+
+// move() moves the highlight by delta matches, scrolling the list to keep
+// it visible
+func (p *picker) move(delta int) {
+	if len(p.matches) == 0 {
+		return
+	}
+	p.cursor += delta
+	if p.cursor < 0 {
+		p.cursor = 0
+	}
+	if p.cursor >= len(p.matches) {
+		p.cursor = len(p.matches) - 1
+	}
+	if p.cursor < p.offset {
+		p.offset = p.cursor
+	}
+	if p.cursor >= p.offset+pickerRows {
+		p.offset = p.cursor - pickerRows + 1
+	}
+}
+
+// run() reads keys from in and redraws the picker on out until a task is
+// chosen or the picker is cancelled
+func (p *picker) run(in io.Reader, out io.Writer) (*core.Task, error) {
+	r := bufio.NewReader(in)
+	defer p.clear(out)
+
+	for {
+		p.draw(out)
+
+		key, _, err := r.ReadRune()
+		if err != nil {
+			return nil, errNoTaskSelected
+		}
+		switch key {
+		case '\r', '\n':
+			if len(p.matches) > 0 {
+				return p.matches[p.cursor], nil
+			}
+		case 3, 4: // Ctrl+C, Ctrl+D
+			return nil, errNoTaskSelected
+		case 27: // Esc, or the start of an escape sequence
+			if r.Buffered() == 0 {
+				return nil, errNoTaskSelected
+			}
+			if next, _ := r.ReadByte(); next != '[' && next != 'O' {
+				continue
+			}
+			switch code, _ := r.ReadByte(); code {
+			case 'A':
+				p.move(-1)
+			case 'B':
+				p.move(1)
+			}
+		case 16: // Ctrl+P
+			p.move(-1)
+		case 14: // Ctrl+N
+			p.move(1)
+		case 127, 8: // Backspace
+			if len(p.query) > 0 {
+				p.query = p.query[:len(p.query)-1]
+				p.filter()
+			}
+		case 21: // Ctrl+U
+			p.query = p.query[:0]
+			p.filter()
+		default:
+			if unicode.IsPrint(key) {
+				p.query = append(p.query, key)
+				p.filter()
+			}
+		}
+	}
+}
+
+// lines() returns the frame to draw: a header, the query and the visible
+// part of the task list
+func (p *picker) lines() []string {
+	lines := []string{
+		"Select a task to run (type to filter, up/down to move, " +
+			"Enter to run, Esc to cancel)",
+		"Filter: " + string(p.query),
+	}
+	if len(p.matches) == 0 {
+		return append(lines, "  no matching tasks")
+	}
+
+	nameWidth := 0
+	for _, task := range p.matches {
+		if len(task.Name) > nameWidth {
+			nameWidth = len(task.Name)
+		}
+	}
+	end := p.offset + pickerRows
+	if end > len(p.matches) {
+		end = len(p.matches)
+	}
+	for i := p.offset; i < end; i++ {
+		task := p.matches[i]
+		marker := "  "
+		if i == p.cursor {
+			marker = "> "
+		}
+		line := fmt.Sprintf(
+			"%s%-*s  %s",
+			marker,
+			nameWidth,
+			task.Name,
+			task.Description,
+		)
+		if len(task.Dependencies) > 0 {
+			line += " (depends on: " +
+				strings.Join(task.Dependencies, ", ") + ")"
+		}
+		lines = append(lines, strings.TrimRight(line, " "))
+	}
+	if len(p.matches) > pickerRows {
+		lines = append(lines, fmt.Sprintf(
+			"  %d/%d tasks",
+			p.cursor+1,
+			len(p.matches),
+		))
+	}
+	return lines
+}
+
+// draw() replaces the previous frame with the current one. Lines are cut
+// to the terminal width so that none of them wraps, which would throw off
+// the number of lines to clear.
+func (p *picker) draw(out io.Writer) {
+	p.clear(out)
+	lines := p.lines()
+	for i, line := range lines {
+		if runes := []rune(line); p.width > 0 && len(runes) >= p.width {
+			line = string(runes[:p.width-1])
+		}
+		if i > 0 {
+			fmt.Fprint(out, "\r\n")
+		}
+		fmt.Fprint(out, line)
+	}
+	p.drawn = len(lines)
+}
+
+// clear() erases the last frame and leaves the cursor where it started
+func (p *picker) clear(out io.Writer) {
+	if p.drawn == 0 {
+		return
+	}
+	if p.drawn > 1 {
+		fmt.Fprintf(out, "\x1b[%dA", p.drawn-1)
+	}
+	fmt.Fprint(out, "\r\x1b[J")
+	p.drawn = 0
+}
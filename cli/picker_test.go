@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ystepanoff/groolp/core"
+)
+
+func pickerTasks() []*core.Task {
+	return []*core.Task{
+		{Name: "_sign", Description: "Sign the binaries"},
+		{Name: "build", Description: "Build the project"},
+		{Name: "deploy", Description: "Ship it", Dependencies: []string{"build"}},
+		{Name: "test", Description: "Run the tests"},
+	}
+}
+
+func TestPicker_Select(t *testing.T) {
+	for _, tc := range []struct {
+		input    string
+		expected string
+	}{
+		{"\r", "build"},
+		{"\x1b[B\x1b[B\r", "test"},
+		{"\x1b[B\x1b[B\x1b[B\x1b[A\r", "deploy"},
+		{"\x0e\r", "deploy"},
+		{"ship\r", "deploy"},
+		{"TESTS\r", "test"},
+		{"xyz\x7f\x7f\x7fte\r", "test"},
+		{"_\r", "_sign"},
+		{"nothing\r\x15\r", "build"},
+	} {
+		p := newPicker(pickerTasks(), 80)
+		task, err := p.run(strings.NewReader(tc.input), new(bytes.Buffer))
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.input, err)
+			continue
+		}
+		if task.Name != tc.expected {
+			t.Errorf("%q: expected %s, got %s", tc.input, tc.expected, task.Name)
+		}
+	}
+}
+
+func TestPicker_Cancel(t *testing.T) {
+	for _, input := range []string{"\x1b", "\x03", "te", ""} {
+		p := newPicker(pickerTasks(), 80)
+		if _, err := p.run(strings.NewReader(input), new(bytes.Buffer)); err != errNoTaskSelected {
+			t.Errorf("%q: expected errNoTaskSelected, got %v", input, err)
+		}
+	}
+}
+
+func TestPicker_Lines(t *testing.T) {
+	p := newPicker(pickerTasks(), 80)
+	p.move(1)
+
+	expected := []string{
+		"Select a task to run (type to filter, up/down to move, " +
+			"Enter to run, Esc to cancel)",
+		"Filter: ",
+		"  build   Build the project",
+		"> deploy  Ship it (depends on: build)",
+		"  test    Run the tests",
+	}
+	if got := p.lines(); fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("Expected lines %q, got %q", expected, got)
+	}
+
+	var buf bytes.Buffer
+	p.draw(&buf)
+	p.clear(&buf)
+	if !strings.HasSuffix(buf.String(), "\x1b[4A\r\x1b[J") {
+		t.Errorf("Expected the frame to be cleared, got %q", buf.String())
+	}
+}
+
+func TestRunCommand_Picker(t *testing.T) {
+	origPickTask := pickTask
+	defer func() { pickTask = origPickTask }()
+
+	tm := core.NewTaskManager()
+	executed := false
+	_ = tm.Register(&core.Task{
+		Name: "build",
+		Action: func(ctx context.Context) error {
+			executed = true
+			return nil
+		},
+	})
+
+	var offered []*core.Task
+	pickTask = func(tasks []*core.Task) (*core.Task, error) {
+		offered = tasks
+		return tasks[0], nil
+	}
+
+	rootCmd := Init(tm, ".groolp")
+	rootCmd.SetOut(new(bytes.Buffer))
+	rootCmd.SetArgs([]string{"run"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(offered) != 1 || !executed {
+		t.Errorf("Expected the picked task to run, offered %v", offered)
+	}
+}
+
+func TestRunCommand_PickerNoTerminal(t *testing.T) {
+	tm := core.NewTaskManager()
+	_ = tm.Register(&core.Task{Name: "build"})
+
+	rootCmd := Init(tm, ".groolp")
+	rootCmd.SetArgs([]string{"run"})
+	err := rootCmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "needs a terminal") {
+		t.Fatalf("Expected an error about the missing terminal, got: %v", err)
+	}
+	if code := ExitCode(err); code != ExitUsage {
+		t.Errorf("Expected exit code %d, got %d", ExitUsage, code)
+	}
+}
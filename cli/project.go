@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ystepanoff/groolp/core"
+)
+
+// GroolpDirEnv names the environment variable that points groolp at a
+// specific .groolp directory instead of searching for one
+const GroolpDirEnv = "GROOLP_DIR"
+
+// FindProject() walks up from dir to the nearest directory that contains
+// a groolpDirName directory, the way git finds .git, and returns the path
+// of that directory.
+func FindProject(dir, groolpDirName string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for start := dir; ; {
+		candidate := filepath.Join(dir, groolpDirName)
+		if fi, err := os.Stat(candidate); err == nil && fi.IsDir() {
+			return candidate, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf(
+				"no groolp project found in %s or any parent directory; "+
+					"run 'groolp init' to create one",
+				start,
+			)
+		}
+		dir = parent
+	}
+}
+
+// ResolveGroolpDir() returns the .groolp directory of the project: the one
+// in projectDir if given, else the one named by $GROOLP_DIR, else the
+// nearest one above the working directory.
+func ResolveGroolpDir(projectDir, groolpDirName string) (string, error) {
+	if projectDir != "" {
+		return filepath.Abs(filepath.Join(projectDir, groolpDirName))
+	}
+	if dir := os.Getenv(GroolpDirEnv); dir != "" {
+		return filepath.Abs(dir)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	return FindProject(cwd, groolpDirName)
+}
+
+// OpenProject() locates the project selected by --project-dir, $GROOLP_DIR
+// or the working directory and makes its root, the parent of the .groolp
+// directory, the working directory, so that task actions, globs and watch
+// paths are resolved against it; --report-file is made absolute first. It
+// returns the .groolp directory relative to the new working directory.
+func OpenProject() (string, error) {
+	dir, err := ResolveGroolpDir(projectDir, defaultGroolpDir)
+	if err != nil {
+		return "", &core.ConfigError{Err: err}
+	}
+	if err := RequireProject(dir); err != nil {
+		return "", &core.ConfigError{Err: err}
+	}
+
+	// Files named on the command line are relative to where groolp was
+	// started, not to the project root
+	if runReportFile != "" && !filepath.IsAbs(runReportFile) {
+		if runReportFile, err = filepath.Abs(runReportFile); err != nil {
+			return "", err
+		}
+	}
+
+	if err := os.Chdir(filepath.Dir(dir)); err != nil {
+		return "", fmt.Errorf("failed to enter project root: %w", err)
+	}
+	groolpDir = filepath.Base(dir)
+	return groolpDir, nil
+}
+
+// initGroolpDir() returns where `groolp init` creates the project: the
+// directory selected by --project-dir or $GROOLP_DIR, or the working
+// directory. Unlike other commands, init does not search parent
+// directories.
+func initGroolpDir() string {
+	if projectDir != "" {
+		return filepath.Join(projectDir, defaultGroolpDir)
+	}
+	if dir := os.Getenv(GroolpDirEnv); dir != "" {
+		return dir
+	}
+	return defaultGroolpDir
+}
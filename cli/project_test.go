@@ -0,0 +1,123 @@
+package cli_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ystepanoff/groolp/cli"
+	"github.com/ystepanoff/groolp/core"
+)
+
+// newProject() creates a project with a nested subdirectory and returns
+// the resolved project root
+func newProject(t *testing.T) string {
+	t.Helper()
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, cli.InitProject(
+		filepath.Join(root, ".groolp"),
+		"empty",
+		false,
+	))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "a", "b"), 0755))
+	return root
+}
+
+// chdir() changes the working directory for the duration of the test
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() {
+		_ = os.Chdir(cwd)
+	})
+}
+
+func TestFindProject(t *testing.T) {
+	root := newProject(t)
+
+	dir, err := cli.FindProject(filepath.Join(root, "a", "b"), ".groolp")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(root, ".groolp"), dir)
+
+	dir, err = cli.FindProject(root, ".groolp")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(root, ".groolp"), dir)
+}
+
+func TestFindProject_NotFound(t *testing.T) {
+	_, err := cli.FindProject(t.TempDir(), ".groolp-missing")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "groolp init")
+}
+
+func TestResolveGroolpDir(t *testing.T) {
+	root := newProject(t)
+	other := newProject(t)
+	chdir(t, filepath.Join(root, "a"))
+	t.Setenv(cli.GroolpDirEnv, "")
+
+	dir, err := cli.ResolveGroolpDir("", ".groolp")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(root, ".groolp"), dir)
+
+	t.Setenv(cli.GroolpDirEnv, filepath.Join(other, ".groolp"))
+	dir, err = cli.ResolveGroolpDir("", ".groolp")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(other, ".groolp"), dir)
+
+	// --project-dir takes precedence over $GROOLP_DIR
+	dir, err = cli.ResolveGroolpDir(root, ".groolp")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(root, ".groolp"), dir)
+}
+
+func TestOpenProject(t *testing.T) {
+	root := newProject(t)
+	chdir(t, t.TempDir())
+	t.Setenv(cli.GroolpDirEnv, "")
+
+	rootCmd := cli.Init(core.NewTaskManager(), ".groolp")
+	rootCmd.SetOut(new(bytes.Buffer))
+	rootCmd.SetArgs([]string{"--project-dir", filepath.Join(root, "a", ".."), "list"})
+	require.NoError(t, rootCmd.Execute())
+
+	groolpDir, err := cli.OpenProject()
+	require.NoError(t, err)
+	require.Equal(t, ".groolp", groolpDir)
+
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+	require.Equal(t, root, cwd, "the project root should be the working directory")
+}
+
+func TestOpenProject_ReportFileFromSubdirectory(t *testing.T) {
+	root := newProject(t)
+	chdir(t, filepath.Join(root, "a"))
+	t.Setenv(cli.GroolpDirEnv, "")
+
+	tm := core.NewTaskManager()
+	require.NoError(t, tm.Register(&core.Task{Name: "build"}))
+	rootCmd := cli.Init(tm, ".groolp")
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		_, err := cli.OpenProject()
+		return err
+	}
+	rootCmd.SetOut(new(bytes.Buffer))
+	rootCmd.SetArgs([]string{
+		"run", "build",
+		"--report", "json",
+		"--report-file", "report.json",
+	})
+	require.NoError(t, rootCmd.Execute())
+
+	// The report lands where groolp was run, not in the project root
+	require.FileExists(t, filepath.Join(root, "a", "report.json"))
+	require.NoFileExists(t, filepath.Join(root, "report.json"))
+}
@@ -1,51 +1,93 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 
+	"github.com/spf13/cobra"
 	"github.com/ystepanoff/groolp/cli"
 	"github.com/ystepanoff/groolp/core"
 	"github.com/ystepanoff/groolp/scripts"
 )
 
-const groolpDir = ".groolp"
+const defaultGroolpDir = ".groolp"
 
 func main() {
-	if err := cli.InitGroolpDirectory(groolpDir); err != nil {
-		fmt.Fprintf(os.Stderr, "Error initializing %s: %v\n", groolpDir, err)
-		os.Exit(1)
+	taskManager := core.NewTaskManager()
+	core.ScriptRunner = scripts.RunScript
+
+	rootCmd := cli.Init(taskManager, defaultGroolpDir)
+
+	// The project is loaded only for commands that need it, so that e.g.
+	// `groolp init` and `groolp --help` work outside of a project
+	var ds *scripts.DataStore
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if !cli.NeedsProject(cmd) {
+			return nil
+		}
+		groolpDir, err := cli.OpenProject()
+		if err != nil {
+			return err
+		}
+
+		ds, err = loadProject(taskManager, groolpDir)
+		if err != nil {
+			return err
+		}
+
+		// Tasks of broken scripts are missing, so nothing can be trusted
+		// to run; validate lists the broken scripts among its problems
+		scriptsDir := filepath.Join(groolpDir, "scripts")
+		err = scripts.LoadScripts(scriptsDir, taskManager)
+		var configErr *core.ConfigError
+		switch {
+		case errors.As(err, &configErr):
+			if !cli.ReportsLoadErrors(cmd) {
+				return err
+			}
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "Error loading scripts at startup: %v\n", err)
+		}
+		return nil
 	}
 
-	taskManager := core.NewTaskManager()
+	err := rootCmd.Execute()
+	if ds != nil {
+		ds.Close()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(cli.ExitCode(err))
+	}
+}
 
+// loadProject() registers the tasks from the tasks.yaml of the project in
+// groolpDir and sets up the task cache and the Lua data store
+func loadProject(
+	taskManager *core.TaskManager,
+	groolpDir string,
+) (*scripts.DataStore, error) {
 	config, err := cli.InitTasksConfig(groolpDir)
 	if err != nil {
-		fmt.Println("Error loading config file:", err)
-		return
+		return nil, err
 	}
 
 	if err := taskManager.RegisterFromConfig(config); err != nil {
-		fmt.Println("Error registering tasks from config:", err)
+		return nil, fmt.Errorf("error registering tasks from config: %w", err)
 	}
 
-	ds, err := scripts.NewDataStore(groolpDir)
+	cache, err := core.LoadTaskCache(filepath.Join(groolpDir, "cache.json"))
 	if err != nil {
-		fmt.Printf("Error initializing data store: %v\n", err)
-		os.Exit(1)
-	}
-	scripts.GlobalDataStore = ds
-
-	scriptsDir := filepath.Join(groolpDir, "scripts")
-	if err := scripts.LoadScripts(scriptsDir, taskManager); err != nil {
-		fmt.Printf("Error loading scripts at startup: %v\n", err)
+		return nil, fmt.Errorf("error loading task cache: %w", err)
 	}
+	taskManager.SetCache(cache)
 
-	rootCmd := cli.Init(taskManager, groolpDir)
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println("Failed to run:", err)
+	ds, err := scripts.NewDataStore(groolpDir)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing data store: %w", err)
 	}
-
-	ds.Close()
+	scripts.GlobalDataStore = ds
+	return ds, nil
 }
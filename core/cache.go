@@ -0,0 +1,189 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// TaskCache keeps the input hashes of successful task runs so that tasks
+// whose inputs have not changed can be skipped.
+type TaskCache struct {
+	path   string
+	hashes map[string]string
+	dirty  bool
+	mu     sync.Mutex
+}
+
+// LoadTaskCache() reads the cache file at path. A missing file yields an
+// empty cache.
+func LoadTaskCache(path string) (*TaskCache, error) {
+	c := &TaskCache{
+		path:   path,
+		hashes: make(map[string]string),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return nil, fmt.Errorf("failed to read task cache: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &c.hashes); err != nil {
+		return nil, fmt.Errorf("failed to parse task cache %s: %w", path, err)
+	}
+	return c, nil
+}
+
+func (c *TaskCache) get(taskName string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hashes[taskName]
+}
+
+func (c *TaskCache) set(taskName, hash string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.hashes[taskName] != hash {
+		c.hashes[taskName] = hash
+		c.dirty = true
+	}
+}
+
+// Save() writes the cache back to disk if it has changed.
+func (c *TaskCache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(c.hashes, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(c.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write task cache: %w", err)
+	}
+	c.dirty = false
+	return nil
+}
+
+// hashInputs() returns a digest of the task's command, its parameter
+// values, its declared inputs and outputs and of the contents of every
+// file matched by its input patterns. Directories matched by a pattern
+// contribute all files below them. The code of the task is covered as
+// well: the Lua script a task from tasks.yaml runs and, for tasks defined
+// in a Lua script, that script.
+func hashInputs(task *Task, params map[string]string) (string, error) {
+	files := make(map[string]bool)
+	for _, pattern := range task.Inputs {
+		matches, err := doublestar.FilepathGlob(pattern)
+		if err != nil {
+			return "", fmt.Errorf("invalid input pattern '%s': %w", pattern, err)
+		}
+		for _, match := range matches {
+			err := filepath.WalkDir(
+				match,
+				func(path string, d fs.DirEntry, err error) error {
+					if err != nil {
+						return err
+					}
+					if d.Type().IsRegular() {
+						files[path] = true
+					}
+					return nil
+				},
+			)
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var code []string
+	if task.Script != "" {
+		code = append(code, task.Script)
+	}
+	if sourceKind(task.Source) == SourceLua {
+		code = append(code, task.Source)
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "command %s\x00", task.Command)
+	for _, path := range code {
+		sum, err := hashFile(path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "code %s %s\x00", filepath.ToSlash(path), sum)
+	}
+	for _, name := range names {
+		fmt.Fprintf(h, "param %s=%s\x00", name, params[name])
+	}
+	for _, pattern := range task.Inputs {
+		fmt.Fprintf(h, "input %s\x00", pattern)
+	}
+	for _, pattern := range task.Outputs {
+		fmt.Fprintf(h, "output %s\x00", pattern)
+	}
+	for _, path := range paths {
+		sum, err := hashFile(path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "file %s %s\x00", filepath.ToSlash(path), sum)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// outputsExist() reports whether every output pattern matches at least
+// one existing path.
+func outputsExist(task *Task) bool {
+	for _, pattern := range task.Outputs {
+		matches, err := doublestar.FilepathGlob(pattern)
+		if err != nil || len(matches) == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,203 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunContext_SkipsUpToDateTasks(t *testing.T) {
+	tmpDir := t.TempDir()
+	src := filepath.Join(tmpDir, "src", "pkg", "main.go")
+	out := filepath.Join(tmpDir, "build", "app")
+	require.NoError(t, os.MkdirAll(filepath.Dir(src), 0755))
+	require.NoError(t, os.WriteFile(src, []byte("package main"), 0644))
+
+	cache, err := LoadTaskCache(filepath.Join(tmpDir, "cache.json"))
+	require.NoError(t, err)
+
+	tm := NewTaskManager()
+	tm.SetCache(cache)
+
+	runs := 0
+	require.NoError(t, tm.Register(&Task{
+		Name:    "build",
+		Inputs:  []string{filepath.Join(tmpDir, "src", "**", "*.go")},
+		Outputs: []string{out},
+		Action: func(ctx context.Context) error {
+			runs++
+			require.NoError(t, os.MkdirAll(filepath.Dir(out), 0755))
+			return os.WriteFile(out, []byte("binary"), 0644)
+		},
+	}))
+
+	require.NoError(t, tm.Run("build"))
+	require.Equal(t, 1, runs)
+
+	// Nothing changed
+	require.NoError(t, tm.Run("build"))
+	require.Equal(t, 1, runs)
+
+	// The cache survives a reload
+	cache, err = LoadTaskCache(filepath.Join(tmpDir, "cache.json"))
+	require.NoError(t, err)
+	tm.SetCache(cache)
+	require.NoError(t, tm.Run("build"))
+	require.Equal(t, 1, runs)
+
+	// Forced runs ignore the cache
+	_, err = tm.RunContext(
+		context.Background(),
+		[]string{"build"},
+		RunOptions{Force: true},
+	)
+	require.NoError(t, err)
+	require.Equal(t, 2, runs)
+
+	// Changed input
+	require.NoError(t, os.WriteFile(src, []byte("package main\n"), 0644))
+	require.NoError(t, tm.Run("build"))
+	require.Equal(t, 3, runs)
+
+	// Missing output
+	require.NoError(t, os.Remove(out))
+	require.NoError(t, tm.Run("build"))
+	require.Equal(t, 4, runs)
+}
+
+func TestRunContext_FailedRunIsNotCached(t *testing.T) {
+	tmpDir := t.TempDir()
+	src := filepath.Join(tmpDir, "input.txt")
+	require.NoError(t, os.WriteFile(src, []byte("data"), 0644))
+
+	cache, err := LoadTaskCache(filepath.Join(tmpDir, "cache.json"))
+	require.NoError(t, err)
+
+	tm := NewTaskManager()
+	tm.SetCache(cache)
+
+	runs := 0
+	fail := true
+	require.NoError(t, tm.Register(&Task{
+		Name:   "gen",
+		Inputs: []string{src},
+		Action: func(ctx context.Context) error {
+			runs++
+			if fail {
+				return os.ErrInvalid
+			}
+			return nil
+		},
+	}))
+
+	require.Error(t, tm.Run("gen"))
+	fail = false
+	require.NoError(t, tm.Run("gen"))
+	require.NoError(t, tm.Run("gen"))
+	require.Equal(t, 2, runs)
+}
+
+func TestRunContext_CacheKeyCoversParamsAndCommand(t *testing.T) {
+	tmpDir := t.TempDir()
+	src := filepath.Join(tmpDir, "input.txt")
+	require.NoError(t, os.WriteFile(src, []byte("data"), 0644))
+
+	cache, err := LoadTaskCache(filepath.Join(tmpDir, "cache.json"))
+	require.NoError(t, err)
+
+	tm := NewTaskManager()
+	tm.SetCache(cache)
+
+	var built []string
+	task := &Task{
+		Name:    "gen",
+		Command: "./gen.sh {{ .target }}",
+		Inputs:  []string{src},
+		Params:  []Param{{Name: "target"}},
+		Action: func(ctx context.Context) error {
+			built = append(built, TaskParams(ctx)["target"])
+			return nil
+		},
+	}
+	require.NoError(t, tm.Register(task))
+
+	run := func(target string) {
+		_, err := tm.RunContext(
+			context.Background(),
+			[]string{"gen"},
+			RunOptions{Params: map[string]string{"target": target}},
+		)
+		require.NoError(t, err)
+	}
+
+	run("linux")
+	run("darwin")
+	run("darwin")
+	require.Equal(t, []string{"linux", "darwin"}, built)
+
+	// Changing the command runs the task again
+	task.Command = "./gen.sh --target {{ .target }}"
+	run("darwin")
+	require.Equal(t, []string{"linux", "darwin", "darwin"}, built)
+}
+
+func TestRunContext_CodeChangeInvalidatesCache(t *testing.T) {
+	tmpDir := t.TempDir()
+	src := filepath.Join(tmpDir, "main.go")
+	script := filepath.Join(tmpDir, "gen.lua")
+	source := filepath.Join(tmpDir, "build.lua")
+	for _, path := range []string{src, script, source} {
+		require.NoError(t, os.WriteFile(path, []byte("-- v1"), 0644))
+	}
+
+	cache, err := LoadTaskCache(filepath.Join(tmpDir, "cache.json"))
+	require.NoError(t, err)
+	tm := NewTaskManager()
+	tm.SetCache(cache)
+
+	runs := map[string]int{}
+	count := func(ctx context.Context) error {
+		runs[TaskParams(ctx)["name"]]++
+		return nil
+	}
+	require.NoError(t, tm.Register(&Task{
+		Name:   "yaml",
+		Script: script,
+		Inputs: []string{src},
+		Params: []Param{{Name: "name", Default: "yaml"}},
+		Action: count,
+		Source: "tasks.yaml",
+	}))
+	require.NoError(t, tm.Register(&Task{
+		Name:   "lua",
+		Inputs: []string{src},
+		Params: []Param{{Name: "name", Default: "lua"}},
+		Action: count,
+		Source: source,
+	}))
+
+	require.NoError(t, tm.Run("yaml", "lua"))
+	require.NoError(t, tm.Run("yaml", "lua"))
+	require.Equal(t, map[string]int{"yaml": 1, "lua": 1}, runs)
+
+	// Editing the script of a YAML task runs it again
+	require.NoError(t, os.WriteFile(script, []byte("-- v2"), 0644))
+	require.NoError(t, tm.Run("yaml", "lua"))
+	require.Equal(t, map[string]int{"yaml": 2, "lua": 1}, runs)
+
+	// So does editing the Lua script a task is defined in
+	require.NoError(t, os.WriteFile(source, []byte("-- v2"), 0644))
+	require.NoError(t, tm.Run("yaml", "lua"))
+	require.Equal(t, map[string]int{"yaml": 2, "lua": 2}, runs)
+}
+
+func TestLoadTaskCache_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	require.NoError(t, os.WriteFile(path, []byte("{not json"), 0644))
+
+	_, err := LoadTaskCache(path)
+	require.Error(t, err)
+}
@@ -1,48 +1,230 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
 
 	"gopkg.in/yaml.v2"
 )
 
 // TasksConfig represents the structure of the tasks configuration file.
 type TasksConfig struct {
-	Tasks map[string]struct {
-		Description  string   `yaml:"description"`
-		Dependencies []string `yaml:"dependencies,omitempty"`
-		Action       string   `yaml:"action"`
-	} `yaml:"tasks"`
+	Tasks map[string]TaskConfig `yaml:"tasks"`
+
+	// Env and EnvFile set environment variables for every task; the
+	// settings of a task take precedence over them.
+	Env     map[string]string `yaml:"env,omitempty"`
+	EnvFile stringList        `yaml:"env_file,omitempty"`
+
+	// dir is the directory holding the configuration file; `script`
+	// paths are resolved against its scripts/ subdirectory.
+	dir string
+	// file is the path of the configuration file, recorded as the source
+	// of its tasks
+	file string
+}
+
+// TaskConfig represents a single task in the tasks configuration file.
+// `action` and `dependencies` are accepted as aliases of `command` and
+// `depends`.
+type TaskConfig struct {
+	Description  string            `yaml:"description"`
+	Command      string            `yaml:"command,omitempty"`
+	Action       string            `yaml:"action,omitempty"`
+	Depends      []string          `yaml:"depends,omitempty"`
+	Dependencies []string          `yaml:"dependencies,omitempty"`
+	Watch        []string          `yaml:"watch,omitempty"`
+	Script       string            `yaml:"script,omitempty"`
+	Env          map[string]string `yaml:"env,omitempty"`
+	EnvFile      stringList        `yaml:"env_file,omitempty"`
+	Timeout      int               `yaml:"timeout,omitempty"`
+	Service      bool              `yaml:"service,omitempty"`
+	GracePeriod  int               `yaml:"grace_period,omitempty"`
+	Inputs       []string          `yaml:"inputs,omitempty"`
+	Outputs      []string          `yaml:"outputs,omitempty"`
+	AllowFailure bool              `yaml:"allow_failure,omitempty"`
+	Params       []Param           `yaml:"params,omitempty"`
+	Dir          string            `yaml:"dir,omitempty"`
 }
 
-// LoadConfig loads and parses the configuration file.
+// ScriptRunner executes the Lua script referenced by a task's `script`
+// key. It is provided by the scripts package.
+var ScriptRunner func(ctx context.Context, scriptPath string) error
+
+// LoadConfig loads and parses the configuration file. Unknown keys are
+// reported as errors.
 func LoadConfig(filename string) (*TasksConfig, error) {
 	data, err := os.ReadFile(filename)
 	if err != nil {
-		return nil, err
+		return nil, &ConfigError{Err: err}
 	}
 
 	var config TasksConfig
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, err
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, &ConfigError{File: filename, Err: err}
 	}
+	config.dir = filepath.Dir(filename)
+	config.file = filename
 
 	return &config, nil
 }
 
-// RegisterTasksFromConfig registers tasks defined in the configuration file.
+// RegisterTasksFromConfig registers tasks defined in the configuration file
+// in the order of their names.
 func (tm *TaskManager) RegisterFromConfig(config *TasksConfig) error {
-	for name, taskData := range config.Tasks {
-		task := NewTaskFromConfig(
-			name,
-			taskData.Description,
-			taskData.Dependencies,
-			taskData.Action,
-		)
+	names := make([]string, 0, len(config.Tasks))
+	for name := range config.Tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		taskData := config.Tasks[name]
+		if err := taskData.validate(); err != nil {
+			return &ConfigError{
+				File: config.file,
+				Err:  fmt.Errorf("invalid task '%s': %w", name, err),
+			}
+		}
+		taskData.Env, taskData.EnvFile = config.taskEnv(taskData)
+		if taskData.Dir != "" {
+			taskData.Dir = config.projectPath(taskData.Dir)
+		}
+		if taskData.Script != "" {
+			taskData.Script = filepath.Join(
+				config.dir,
+				"scripts",
+				taskData.Script,
+			)
+		}
+
+		task := NewTaskFromConfig(name, taskData)
+		task.Source = config.file
+		if task.Source == "" {
+			task.Source = "tasks.yaml"
+		}
 		if err := tm.Register(task); err != nil {
-			return fmt.Errorf("failed to register task '%s': %w", name, err)
+			return &ConfigError{
+				File: config.file,
+				Err:  fmt.Errorf("failed to register task '%s': %w", name, err),
+			}
+		}
+	}
+	return nil
+}
+
+// taskEnv() merges the global environment settings into those of a task.
+// Env files are resolved against the project root, and global ones are
+// loaded first.
+func (config *TasksConfig) taskEnv(tc TaskConfig) (map[string]string, []string) {
+	env := make(map[string]string, len(config.Env)+len(tc.Env))
+	for key, value := range config.Env {
+		env[key] = value
+	}
+	for key, value := range tc.Env {
+		env[key] = value
+	}
+
+	envFiles := make([]string, 0, len(config.EnvFile)+len(tc.EnvFile))
+	envFiles = append(envFiles, config.EnvFile...)
+	envFiles = append(envFiles, tc.EnvFile...)
+	for i, file := range envFiles {
+		envFiles[i] = config.projectPath(file)
+	}
+	return env, envFiles
+}
+
+// projectPath() resolves a path against the project root, the parent of
+// the .groolp directory
+func (config *TasksConfig) projectPath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(config.dir), path)
+}
+
+// environ() returns the task's variables as sorted KEY=value pairs
+func (tc TaskConfig) environ() ([]string, error) {
+	vars := make(map[string]string)
+	for _, file := range tc.EnvFile {
+		fileVars, err := LoadEnvFile(file)
+		if err != nil {
+			return nil, err
 		}
+		for key, value := range fileVars {
+			vars[key] = value
+		}
+	}
+	for key, value := range tc.Env {
+		vars[key] = value
+	}
+
+	env := make([]string, 0, len(vars))
+	for key, value := range vars {
+		env = append(env, key+"="+value)
+	}
+	sort.Strings(env)
+	return env, nil
+}
+
+// command() returns the shell command of the task, whichever key was used
+func (tc TaskConfig) command() string {
+	if tc.Command != "" {
+		return tc.Command
+	}
+	return tc.Action
+}
+
+// dependencies() returns the task dependencies, whichever key was used
+func (tc TaskConfig) dependencies() []string {
+	if len(tc.Depends) > 0 {
+		return tc.Depends
+	}
+	return tc.Dependencies
+}
+
+func (tc TaskConfig) validate() error {
+	if tc.Command != "" && tc.Action != "" {
+		return fmt.Errorf("'command' and 'action' are aliases, use only one")
+	}
+	if len(tc.Depends) > 0 && len(tc.Dependencies) > 0 {
+		return fmt.Errorf(
+			"'depends' and 'dependencies' are aliases, use only one",
+		)
+	}
+	if tc.Timeout < 0 {
+		return fmt.Errorf("'timeout' must not be negative")
+	}
+	if tc.GracePeriod < 0 {
+		return fmt.Errorf("'grace_period' must not be negative")
+	}
+	if err := validateParams(tc.Params); err != nil {
+		return err
+	}
+	if _, err := parseCommand("", tc); err != nil {
+		return err
+	}
+	return nil
+}
+
+// stringList is a YAML value that may be written as a single string or as
+// a list of strings
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var single string
+	if err := unmarshal(&single); err == nil {
+		*l = stringList{single}
+		return nil
+	}
+
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return err
 	}
+	*l = list
 	return nil
 }
@@ -0,0 +1,192 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tasks.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestLoadConfig_DocumentedKeys(t *testing.T) {
+	path := writeConfig(t, `
+tasks:
+  prepare:
+    action: "true"
+  validate:
+    command: "true"
+  complex-task:
+    command: ./build.sh
+    description: Complex build task
+    depends:
+      - prepare
+      - validate
+    watch:
+      - "src/**/*"
+      - "config/*.yaml"
+    script: complex_build.lua
+    env:
+      GOOS: linux
+      CGO_ENABLED: 0
+    timeout: 300
+  serve:
+    command: go run .
+    depends:
+      - validate
+    service: true
+    grace_period: 5
+`)
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+
+	tm := NewTaskManager()
+	require.NoError(t, tm.RegisterFromConfig(config))
+
+	task, err := tm.retrieveAndCheck("complex-task", nil)
+	require.NoError(t, err)
+	require.Equal(t, "Complex build task", task.Description)
+	require.Equal(t, []string{"prepare", "validate"}, task.Dependencies)
+	require.Equal(t, []string{"src/**/*", "config/*.yaml"}, task.Watch)
+
+	tc := config.Tasks["complex-task"]
+	require.Equal(t, "0", tc.Env["CGO_ENABLED"])
+	require.Equal(t, 300, tc.Timeout)
+
+	task, err = tm.retrieveAndCheck("serve", nil)
+	require.NoError(t, err)
+	require.True(t, task.Service)
+	require.Equal(t, 5*time.Second, task.GracePeriod)
+}
+
+func TestLoadConfig_UnknownKey(t *testing.T) {
+	path := writeConfig(t, `
+tasks:
+  build:
+    comand: go build ./...
+`)
+	_, err := LoadConfig(path)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "comand")
+}
+
+func TestRegisterFromConfig_ConflictingAliases(t *testing.T) {
+	tm := NewTaskManager()
+	err := tm.RegisterFromConfig(&TasksConfig{
+		Tasks: map[string]TaskConfig{
+			"build": {Command: "make", Action: "make all"},
+		},
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "aliases")
+
+	err = tm.RegisterFromConfig(&TasksConfig{
+		Tasks: map[string]TaskConfig{
+			"build": {Depends: []string{"a"}, Dependencies: []string{"b"}},
+		},
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "aliases")
+}
+
+func TestNewTaskFromConfig_EnvAndTimeout(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "env.txt")
+
+	task := NewTaskFromConfig("env", TaskConfig{
+		Command: `printf "%s" "$GROOLP_TEST_VALUE" > ` + out,
+		Env:     map[string]string{"GROOLP_TEST_VALUE": "from-config"},
+	})
+	require.NoError(t, task.Action(context.Background()))
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	require.Equal(t, "from-config", string(data))
+
+	tm := NewTaskManager()
+	require.NoError(t, tm.Register(NewTaskFromConfig("slow", TaskConfig{
+		Command: "sleep 5",
+		Timeout: 1,
+	})))
+	start := time.Now()
+	err = tm.Run("slow")
+	require.Less(t, time.Since(start), 4*time.Second)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "timed out after 1s")
+}
+
+func TestRegisterFromConfig_Script(t *testing.T) {
+	origRunner := ScriptRunner
+	defer func() { ScriptRunner = origRunner }()
+
+	var ran string
+	ScriptRunner = func(ctx context.Context, scriptPath string) error {
+		ran = scriptPath
+		return nil
+	}
+
+	path := writeConfig(t, `
+tasks:
+  scripted:
+    script: custom_task.lua
+`)
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+
+	tm := NewTaskManager()
+	require.NoError(t, tm.RegisterFromConfig(config))
+	require.NoError(t, tm.Run("scripted"))
+	require.Equal(
+		t,
+		filepath.Join(filepath.Dir(path), "scripts", "custom_task.lua"),
+		ran,
+	)
+}
+
+func TestRegisterFromConfig_Dir(t *testing.T) {
+	root := t.TempDir()
+	groolpDir := filepath.Join(root, ".groolp")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "services", "api"), 0755))
+	require.NoError(t, os.Mkdir(groolpDir, 0755))
+	path := filepath.Join(groolpDir, "tasks.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+tasks:
+  api:
+    command: basename "$PWD"
+    dir: services/api
+  web:
+    command: "true"
+    dir: services/web
+`), 0644))
+
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+	tm := NewTaskManager()
+	require.NoError(t, tm.RegisterFromConfig(config))
+
+	err = tm.Validate()
+	require.Error(t, err)
+	require.Equal(
+		t,
+		fmt.Sprintf(
+			"task 'web': directory '%s' does not exist",
+			filepath.Join(root, "services", "web"),
+		),
+		err.Error(),
+	)
+
+	results, err := tm.RunContext(
+		context.Background(),
+		[]string{"api"},
+		RunOptions{CaptureOutput: true},
+	)
+	require.NoError(t, err)
+	require.Equal(t, "api\n", results[0].Output)
+}
@@ -0,0 +1,100 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	require.NoError(t, os.WriteFile(path, []byte(`
+# comment
+PLAIN=value
+export EXPORTED=yes
+SPACED = padded value # trailing comment
+EMPTY=
+SINGLE='literal \n $HOME'
+DOUBLE="line1\nline2 \"quoted\""
+URL=http://example.com/#anchor
+`), 0644))
+
+	env, err := LoadEnvFile(path)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"PLAIN":    "value",
+		"EXPORTED": "yes",
+		"SPACED":   "padded value",
+		"EMPTY":    "",
+		"SINGLE":   `literal \n $HOME`,
+		"DOUBLE":   "line1\nline2 \"quoted\"",
+		"URL":      "http://example.com/#anchor",
+	}, env)
+}
+
+func TestLoadEnvFile_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	for content, expected := range map[string]string{
+		"VALID=1\nnot a variable\n": ".env:2: expected KEY=value",
+		"KEY=\"unterminated\n":      ".env:1: unterminated quoted value",
+		"KEY='a' b\n":               ".env:1: unexpected text after quoted value",
+	} {
+		path := filepath.Join(dir, ".env")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		_, err := LoadEnvFile(path)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), expected)
+	}
+
+	_, err := LoadEnvFile(filepath.Join(dir, "missing.env"))
+	require.Error(t, err)
+}
+
+func TestRegisterFromConfig_EnvPrecedence(t *testing.T) {
+	root := t.TempDir()
+	groolpDir := filepath.Join(root, ".groolp")
+	require.NoError(t, os.Mkdir(groolpDir, 0755))
+	require.NoError(t, os.WriteFile(
+		filepath.Join(root, ".env"),
+		[]byte("A=global-file\nB=global-file\nC=global-file\nD=global-file\n"),
+		0644,
+	))
+	require.NoError(t, os.WriteFile(
+		filepath.Join(root, "task.env"),
+		[]byte("B=task-file\nC=task-file\n"),
+		0644,
+	))
+	path := filepath.Join(groolpDir, "tasks.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+env_file: .env
+env:
+  C: global-env
+  D: global-env
+tasks:
+  show:
+    command: echo "$A $B $C $D"
+    env_file: [task.env]
+    env:
+      D: task-env
+`), 0644))
+
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+	tm := NewTaskManager()
+	require.NoError(t, tm.RegisterFromConfig(config))
+
+	results, err := tm.RunContext(
+		context.Background(),
+		[]string{"show"},
+		RunOptions{CaptureOutput: true},
+	)
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		"global-file task-file global-env task-env\n",
+		results[0].Output,
+	)
+}
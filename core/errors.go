@@ -0,0 +1,68 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+)
+
+// UnknownTaskError reports a task name that is not registered, along with
+// the closest registered names
+type UnknownTaskError struct {
+	Name        string
+	Suggestions []string
+}
+
+func (e *UnknownTaskError) Error() string {
+	return fmt.Sprintf(
+		"task '%s' not found%s",
+		e.Name,
+		didYouMean(e.Suggestions),
+	)
+}
+
+// ConfigError reports a problem with the task definitions, such as an
+// invalid tasks.yaml, a dependency on an unknown task or a circular
+// dependency. File is the configuration file at fault, if known.
+type ConfigError struct {
+	File string
+	Err  error
+}
+
+func (e *ConfigError) Error() string {
+	if e.File == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s: %v", e.File, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// ParamError reports parameter values given for a run that the tasks do
+// not accept
+type ParamError struct {
+	Err error
+}
+
+func (e *ParamError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ParamError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError reports every problem Validate() found in the task
+// graph, one error per problem
+type ValidationError struct {
+	Problems []error
+}
+
+func (e *ValidationError) Error() string {
+	return errors.Join(e.Problems...).Error()
+}
+
+func (e *ValidationError) Unwrap() []error {
+	return e.Problems
+}
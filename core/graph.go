@@ -0,0 +1,227 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Task sources as reported by a Graph
+const (
+	SourceYAML = "yaml"
+	SourceLua  = "lua"
+)
+
+// Graph is the dependency graph of registered tasks
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// GraphNode is a task in a Graph
+type GraphNode struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Source is SourceYAML or SourceLua, or empty for tasks registered
+	// in Go
+	Source string `json:"source,omitempty"`
+	// File is the file the task was defined in
+	File string `json:"file,omitempty"`
+	// Missing marks a dependency that is not registered as a task
+	Missing bool `json:"missing,omitempty"`
+}
+
+// GraphEdge points from a task to one of its dependencies
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Graph() returns the dependency graph of the given tasks, or of every
+// registered task if none are given. Nodes and edges are sorted by name.
+func (tm *TaskManager) Graph(taskNames ...string) (*Graph, error) {
+	tm.mu.Lock()
+	tasks := make(map[string]*Task, len(tm.tasks))
+	for name, task := range tm.tasks {
+		tasks[name] = task
+	}
+	tm.mu.Unlock()
+
+	// Collect the tasks reachable from the targets, including unknown
+	// dependencies so that they show up in the graph
+	names := make(map[string]bool)
+	var visit func(name string)
+	visit = func(name string) {
+		if names[name] {
+			return
+		}
+		names[name] = true
+		if task, ok := tasks[name]; ok {
+			for _, dep := range task.Dependencies {
+				visit(dep)
+			}
+		}
+	}
+	if len(taskNames) == 0 {
+		for name := range tasks {
+			visit(name)
+		}
+	}
+	for _, taskName := range taskNames {
+		if _, ok := tasks[taskName]; !ok {
+			known := make([]string, 0, len(tasks))
+			for name := range tasks {
+				known = append(known, name)
+			}
+			return nil, &UnknownTaskError{
+				Name:        taskName,
+				Suggestions: suggestNames(taskName, known),
+			}
+		}
+		visit(taskName)
+	}
+
+	g := &Graph{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	for name := range names {
+		task, ok := tasks[name]
+		if !ok {
+			g.Nodes = append(g.Nodes, GraphNode{Name: name, Missing: true})
+			continue
+		}
+		g.Nodes = append(g.Nodes, GraphNode{
+			Name:        name,
+			Description: task.Description,
+			Source:      sourceKind(task.Source),
+			File:        task.Source,
+		})
+		for _, dep := range task.Dependencies {
+			g.Edges = append(g.Edges, GraphEdge{From: name, To: dep})
+		}
+	}
+
+	sort.Slice(g.Nodes, func(i, j int) bool {
+		return g.Nodes[i].Name < g.Nodes[j].Name
+	})
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		return g.Edges[i].To < g.Edges[j].To
+	})
+	return g, nil
+}
+
+// sourceKind() tells from the file a task was defined in whether it came
+// from a Lua script or from tasks.yaml
+func sourceKind(file string) string {
+	switch {
+	case file == "":
+		return ""
+	case strings.EqualFold(filepath.Ext(file), ".lua"):
+		return SourceLua
+	default:
+		return SourceYAML
+	}
+}
+
+// WriteDOT() prints the graph in Graphviz DOT format. YAML tasks are drawn
+// as boxes and Lua tasks as ellipses.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph groolp {\n")
+	b.WriteString("  rankdir=LR;\n")
+	for _, node := range g.Nodes {
+		attrs := []string{"label=" + dotQuote(nodeLabel(node))}
+		switch {
+		case node.Missing:
+			attrs = append(attrs, "style=dashed", "color=red")
+		case node.Source == SourceYAML:
+			attrs = append(attrs, "shape=box")
+		case node.Source == SourceLua:
+			attrs = append(attrs, "shape=ellipse")
+		}
+		fmt.Fprintf(
+			&b,
+			"  %s [%s];\n",
+			dotQuote(node.Name),
+			strings.Join(attrs, ", "),
+		)
+	}
+	for _, edge := range g.Edges {
+		fmt.Fprintf(
+			&b,
+			"  %s -> %s;\n",
+			dotQuote(edge.From),
+			dotQuote(edge.To),
+		)
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteMermaid() prints the graph as a Mermaid flowchart. YAML tasks are
+// drawn as rectangles and Lua tasks as rounded boxes.
+func (g *Graph) WriteMermaid(w io.Writer) error {
+	ids := make(map[string]string, len(g.Nodes))
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for i, node := range g.Nodes {
+		// Task names may contain characters Mermaid does not allow in
+		// node ids, so nodes get generated ids and the name as label
+		id := fmt.Sprintf("t%d", i)
+		ids[node.Name] = id
+		label := mermaidQuote(nodeLabel(node))
+		switch node.Source {
+		case SourceLua:
+			fmt.Fprintf(&b, "  %s(%s)\n", id, label)
+		default:
+			fmt.Fprintf(&b, "  %s[%s]\n", id, label)
+		}
+	}
+	for _, edge := range g.Edges {
+		fmt.Fprintf(&b, "  %s --> %s\n", ids[edge.From], ids[edge.To])
+	}
+	for _, node := range g.Nodes {
+		if node.Missing {
+			fmt.Fprintf(
+				&b,
+				"  style %s stroke:#f00,stroke-dasharray:5\n",
+				ids[node.Name],
+			)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteJSON() prints the graph as JSON for tooling
+func (g *Graph) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(g)
+}
+
+func nodeLabel(node GraphNode) string {
+	switch {
+	case node.Missing:
+		return node.Name + " (missing)"
+	case node.Source != "":
+		return node.Name + " (" + node.Source + ")"
+	default:
+		return node.Name
+	}
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func mermaidQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"`
+}
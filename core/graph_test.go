@@ -0,0 +1,98 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func registerMixedSources(t *testing.T, tm *TaskManager) {
+	t.Helper()
+	require.NoError(t, tm.RegisterFromConfig(&TasksConfig{
+		Tasks: map[string]TaskConfig{
+			"clean": {Command: "true"},
+			"build": {Command: "true", Depends: []string{"clean", "generate"}},
+		},
+		file: ".groolp/tasks.yaml",
+	}))
+	require.NoError(t, tm.Register(&Task{
+		Name:         "generate",
+		Dependencies: []string{"clean"},
+		Source:       ".groolp/scripts/gen.lua",
+	}))
+	require.NoError(t, tm.Register(&Task{
+		Name:         "release",
+		Dependencies: []string{"build", "sign"},
+	}))
+}
+
+func TestGraph_Full(t *testing.T) {
+	tm := NewTaskManager()
+	registerMixedSources(t, tm)
+
+	g, err := tm.Graph()
+	require.NoError(t, err)
+	require.Equal(t, []GraphNode{
+		{Name: "build", Source: SourceYAML, File: ".groolp/tasks.yaml"},
+		{Name: "clean", Source: SourceYAML, File: ".groolp/tasks.yaml"},
+		{Name: "generate", Source: SourceLua, File: ".groolp/scripts/gen.lua"},
+		{Name: "release"},
+		{Name: "sign", Missing: true},
+	}, g.Nodes)
+	require.Equal(t, []GraphEdge{
+		{From: "build", To: "clean"},
+		{From: "build", To: "generate"},
+		{From: "generate", To: "clean"},
+		{From: "release", To: "build"},
+		{From: "release", To: "sign"},
+	}, g.Edges)
+}
+
+func TestGraph_Target(t *testing.T) {
+	tm := NewTaskManager()
+	registerMixedSources(t, tm)
+
+	g, err := tm.Graph("generate")
+	require.NoError(t, err)
+	require.Len(t, g.Nodes, 2)
+	require.Equal(t, []GraphEdge{{From: "generate", To: "clean"}}, g.Edges)
+
+	_, err = tm.Graph("deploy")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "task 'deploy' not found")
+}
+
+func TestGraph_Formats(t *testing.T) {
+	tm := NewTaskManager()
+	registerMixedSources(t, tm)
+	g, err := tm.Graph("build")
+	require.NoError(t, err)
+
+	var dot bytes.Buffer
+	require.NoError(t, g.WriteDOT(&dot))
+	require.Contains(t, dot.String(), `"build" [label="build (yaml)", shape=box];`)
+	require.Contains(t, dot.String(), `"generate" [label="generate (lua)", shape=ellipse];`)
+	require.Contains(t, dot.String(), `"build" -> "generate";`)
+
+	var mermaid bytes.Buffer
+	require.NoError(t, g.WriteMermaid(&mermaid))
+	require.Equal(
+		t,
+		"flowchart LR\n"+
+			"  t0[\"build (yaml)\"]\n"+
+			"  t1[\"clean (yaml)\"]\n"+
+			"  t2(\"generate (lua)\")\n"+
+			"  t0 --> t1\n"+
+			"  t0 --> t2\n"+
+			"  t2 --> t1\n",
+		mermaid.String(),
+	)
+
+	var buf bytes.Buffer
+	require.NoError(t, g.WriteJSON(&buf))
+	var decoded Graph
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	require.Equal(t, g, &decoded)
+}
@@ -0,0 +1,27 @@
+package core
+
+import "context"
+
+// TaskLock keeps the tasks that share it from running at the same time,
+// e.g. the tasks of one Lua script, which share a single Lua state
+type TaskLock struct {
+	ch chan struct{}
+}
+
+func NewTaskLock() *TaskLock {
+	return &TaskLock{ch: make(chan struct{}, 1)}
+}
+
+// lock() waits until no other task holds the lock, or until ctx is done
+func (l *TaskLock) lock(ctx context.Context) error {
+	select {
+	case l.ch <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *TaskLock) unlock() {
+	<-l.ch
+}
@@ -0,0 +1,193 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Param declares a named parameter a task accepts from the command line
+type Param struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+	// Default is used when no value is given
+	Default string `yaml:"default,omitempty"`
+	// Required parameters must be given a value for the task to run
+	Required bool `yaml:"required,omitempty"`
+	// Enum, if set, lists the values the parameter accepts
+	Enum []string `yaml:"enum,omitempty"`
+}
+
+type taskParamsKey struct{}
+
+// TaskParams() returns the parameter values of the running task, with
+// defaults applied. It is empty for tasks that declare no parameters.
+func TaskParams(ctx context.Context) map[string]string {
+	if params, ok := ctx.Value(taskParamsKey{}).(map[string]string); ok {
+		return params
+	}
+	return map[string]string{}
+}
+
+func withParams(ctx context.Context, params map[string]string) context.Context {
+	return context.WithValue(ctx, taskParamsKey{}, params)
+}
+
+// CheckParams() reports the problems with parameter values that would
+// make a run of the given targets fail before anything runs, e.g. for a
+// dry run
+func (tm *TaskManager) CheckParams(
+	taskNames []string,
+	values map[string]string,
+) error {
+	_, err := tm.resolveParams(taskNames, values)
+	return err
+}
+
+// resolveParams() works out the parameter values of every task reachable
+// from the targets. A value applies to every task that declares a
+// parameter of that name. Values for parameters no task declares, missing
+// required parameters and values outside a parameter's enum are all
+// reported together, before anything runs.
+func (tm *TaskManager) resolveParams(
+	taskNames []string,
+	values map[string]string,
+) (map[string]map[string]string, error) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	var order []*Task
+	visited := make(map[string]bool)
+	var visit func(name string)
+	visit = func(name string) {
+		task, ok := tm.tasks[name]
+		if visited[name] || !ok {
+			return
+		}
+		visited[name] = true
+		for _, dep := range task.Dependencies {
+			visit(dep)
+		}
+		order = append(order, task)
+	}
+	for _, taskName := range taskNames {
+		visit(taskName)
+	}
+
+	var problems []error
+	declared := make(map[string]bool)
+	resolved := make(map[string]map[string]string, len(order))
+	for _, task := range order {
+		params := make(map[string]string, len(task.Params))
+		for _, param := range task.Params {
+			declared[param.Name] = true
+			value, given := values[param.Name]
+			if !given {
+				if param.Required {
+					problems = append(problems, fmt.Errorf(
+						"task '%s' requires parameter '%s'",
+						task.Name,
+						param.Name,
+					))
+					continue
+				}
+				value = param.Default
+			}
+			if given && len(param.Enum) > 0 && !contains(param.Enum, value) {
+				problems = append(problems, fmt.Errorf(
+					"invalid value '%s' for parameter '%s' of task '%s' "+
+						"(expected one of: %s)",
+					value,
+					param.Name,
+					task.Name,
+					strings.Join(param.Enum, ", "),
+				))
+				continue
+			}
+			params[param.Name] = value
+		}
+		resolved[task.Name] = params
+	}
+
+	unknown := make([]string, 0, len(values))
+	for name := range values {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		problems = append(problems, fmt.Errorf(
+			"unknown parameter '%s': no task in the run declares it",
+			name,
+		))
+	}
+
+	if len(problems) > 0 {
+		return resolved, &ParamError{Err: errors.Join(problems...)}
+	}
+	return resolved, nil
+}
+
+// validateParams() checks a task's parameter declarations
+func validateParams(params []Param) error {
+	seen := make(map[string]bool, len(params))
+	for _, param := range params {
+		if !isParamName(param.Name) {
+			return fmt.Errorf(
+				"invalid parameter name '%s': use letters, digits and "+
+					"underscores, starting with a letter or underscore",
+				param.Name,
+			)
+		}
+		if seen[param.Name] {
+			return fmt.Errorf("parameter '%s' is declared twice", param.Name)
+		}
+		seen[param.Name] = true
+
+		if param.Required && param.Default != "" {
+			return fmt.Errorf(
+				"required parameter '%s' must not have a default",
+				param.Name,
+			)
+		}
+		if len(param.Enum) > 0 && param.Default != "" &&
+			!contains(param.Enum, param.Default) {
+			return fmt.Errorf(
+				"default '%s' of parameter '%s' is not one of: %s",
+				param.Default,
+				param.Name,
+				strings.Join(param.Enum, ", "),
+			)
+		}
+	}
+	return nil
+}
+
+// isParamName() reports whether name can be used in an action template
+// as {{ .name }}
+func isParamName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case i > 0 && r >= '0' && r <= '9':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package core
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunContext_Params(t *testing.T) {
+	tm := NewTaskManager()
+	var got map[string]string
+	require.NoError(t, tm.Register(&Task{
+		Name: "deploy",
+		Params: []Param{
+			{Name: "env", Required: true, Enum: []string{"staging", "prod"}},
+			{Name: "region", Default: "eu"},
+		},
+		Action: func(ctx context.Context) error {
+			got = TaskParams(ctx)
+			return nil
+		},
+	}))
+
+	_, err := tm.RunContext(
+		context.Background(),
+		[]string{"deploy"},
+		RunOptions{Params: map[string]string{"env": "staging"}},
+	)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"env": "staging", "region": "eu"}, got)
+}
+
+func TestRunContext_InvalidParams(t *testing.T) {
+	tm := NewTaskManager()
+	ran := false
+	require.NoError(t, tm.Register(&Task{
+		Name: "build",
+		Action: func(ctx context.Context) error {
+			ran = true
+			return nil
+		},
+	}))
+	require.NoError(t, tm.Register(&Task{
+		Name:         "deploy",
+		Dependencies: []string{"build"},
+		Params: []Param{
+			{Name: "env", Required: true},
+			{Name: "mode", Enum: []string{"fast", "safe"}},
+		},
+	}))
+
+	_, err := tm.RunContext(
+		context.Background(),
+		[]string{"deploy"},
+		RunOptions{Params: map[string]string{"mode": "yolo", "envv": "x"}},
+	)
+	require.Error(t, err)
+	require.False(t, ran, "nothing may run when parameters are invalid")
+	require.Equal(t, []string{
+		"task 'deploy' requires parameter 'env'",
+		"invalid value 'yolo' for parameter 'mode' of task 'deploy' " +
+			"(expected one of: fast, safe)",
+		"unknown parameter 'envv': no task in the run declares it",
+	}, strings.Split(err.Error(), "\n"))
+}
+
+func TestNewTaskFromConfig_ParamSubstitution(t *testing.T) {
+	tm := NewTaskManager()
+	require.NoError(t, tm.Register(NewTaskFromConfig("deploy", TaskConfig{
+		Command: "echo deploying {{ .version }} to {{ .env }}",
+		Params:  []Param{{Name: "env"}, {Name: "version", Default: "1.0"}},
+	})))
+
+	results, err := tm.RunContext(
+		context.Background(),
+		[]string{"deploy"},
+		RunOptions{CaptureOutput: true, Params: map[string]string{"env": "staging"}},
+	)
+	require.NoError(t, err)
+	require.Equal(t, "deploying 1.0 to staging\n", results[0].Output)
+}
+
+func TestNewTaskFromConfig_ParamsAreQuoted(t *testing.T) {
+	tm := NewTaskManager()
+	require.NoError(t, tm.Register(NewTaskFromConfig("greet", TaskConfig{
+		Command: "echo hello {{ .name }}",
+		Params:  []Param{{Name: "name"}},
+	})))
+
+	name := `x; echo INJECTED 'single' "double"`
+	results, err := tm.RunContext(
+		context.Background(),
+		[]string{"greet"},
+		RunOptions{CaptureOutput: true, Params: map[string]string{"name": name}},
+	)
+	require.NoError(t, err)
+	require.Equal(t, "hello "+name+"\n", results[0].Output)
+}
+
+func TestNewTaskFromConfig_NoParamsNoTemplate(t *testing.T) {
+	// Commands of tasks without parameters are run as written
+	tm := NewTaskManager()
+	require.NoError(t, tm.RegisterFromConfig(&TasksConfig{
+		Tasks: map[string]TaskConfig{
+			"list": {Command: "echo '{{.ImportPath}}'"},
+			"ps":   {Command: "echo '{{ json . }}'"},
+		},
+	}))
+
+	results, err := tm.RunContext(
+		context.Background(),
+		[]string{"list", "ps"},
+		RunOptions{CaptureOutput: true},
+	)
+	require.NoError(t, err)
+	require.Equal(t, "{{.ImportPath}}\n", results[0].Output)
+	require.Equal(t, "{{ json . }}\n", results[1].Output)
+}
+
+func TestRegisterFromConfig_InvalidParams(t *testing.T) {
+	for _, tc := range []struct {
+		config TaskConfig
+		err    string
+	}{
+		{
+			TaskConfig{Params: []Param{{Name: "my-env"}}},
+			"invalid parameter name 'my-env'",
+		},
+		{
+			TaskConfig{Params: []Param{{Name: "env"}, {Name: "env"}}},
+			"parameter 'env' is declared twice",
+		},
+		{
+			TaskConfig{Params: []Param{
+				{Name: "env", Default: "dev", Enum: []string{"prod"}},
+			}},
+			"default 'dev' of parameter 'env' is not one of: prod",
+		},
+		{
+			TaskConfig{
+				Command: "echo {{ .env }",
+				Params:  []Param{{Name: "env"}},
+			},
+			"invalid command",
+		},
+	} {
+		tm := NewTaskManager()
+		err := tm.RegisterFromConfig(&TasksConfig{
+			Tasks: map[string]TaskConfig{"deploy": tc.config},
+		})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), tc.err)
+	}
+}
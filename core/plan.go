@@ -0,0 +1,115 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Plan describes how a run of the given targets would execute, without
+// running anything
+type Plan struct {
+	Targets []string   `json:"targets"`
+	Steps   []PlanStep `json:"tasks"`
+	// Levels groups the tasks by level; tasks on the same level do not
+	// depend on each other, so they may run concurrently with --jobs
+	Levels [][]string `json:"levels"`
+}
+
+// PlanStep is a single task in a Plan
+type PlanStep struct {
+	Task         string   `json:"name"`
+	Description  string   `json:"description,omitempty"`
+	Dependencies []string `json:"dependencies,omitempty"`
+	// Target is the run target that pulls the task into the run
+	Target string `json:"target"`
+	// Level is the 1-based position of the task in the execution order
+	Level int `json:"level"`
+}
+
+// Plan() resolves the graphs of the given targets the same way a run does
+// and returns the order in which their tasks would execute.
+func (tm *TaskManager) Plan(taskNames ...string) (*Plan, error) {
+	for _, taskName := range taskNames {
+		if _, err := tm.retrieveAndCheck(taskName, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	plan := &Plan{Targets: taskNames, Steps: []PlanStep{}}
+	session := newRunSession()
+	offset := 0
+	for _, taskName := range taskNames {
+		if session.executed[taskName] {
+			continue
+		}
+		g, err := tm.buildGraph(taskName, session)
+		if err != nil {
+			return nil, err
+		}
+
+		// Targets run one after another, so each one starts on a new level
+		levels := make(map[string]int, len(g.order))
+		maxLevel := 0
+		for _, task := range g.order {
+			level := offset + 1
+			for _, dep := range g.deps[task.Name] {
+				if levels[dep] >= level {
+					level = levels[dep] + 1
+				}
+			}
+			levels[task.Name] = level
+			if level > maxLevel {
+				maxLevel = level
+			}
+
+			plan.Steps = append(plan.Steps, PlanStep{
+				Task:         task.Name,
+				Description:  task.Description,
+				Dependencies: task.Dependencies,
+				Target:       taskName,
+				Level:        level,
+			})
+			session.executed[task.Name] = true
+		}
+		offset = maxLevel
+	}
+
+	plan.Levels = make([][]string, offset)
+	for _, step := range plan.Steps {
+		plan.Levels[step.Level-1] = append(plan.Levels[step.Level-1], step.Task)
+	}
+	return plan, nil
+}
+
+// WriteText() prints the plan as one line per level
+func (p *Plan) WriteText(w io.Writer) error {
+	if _, err := fmt.Fprintf(
+		w,
+		"Execution plan for %s (%d tasks, %d levels):\n",
+		strings.Join(p.Targets, ", "),
+		len(p.Steps),
+		len(p.Levels),
+	); err != nil {
+		return err
+	}
+
+	for i, level := range p.Levels {
+		line := fmt.Sprintf("  %d. %s", i+1, strings.Join(level, ", "))
+		if len(level) > 1 {
+			line += " (independent)"
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON() prints the plan as JSON for tooling
+func (p *Plan) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(p)
+}
@@ -0,0 +1,111 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func registerPipeline(t *testing.T, tm *TaskManager, ran *[]string) {
+	t.Helper()
+	record := func(name string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			*ran = append(*ran, name)
+			return nil
+		}
+	}
+	require.NoError(t, tm.Register(&Task{Name: "clean", Action: record("clean")}))
+	require.NoError(t, tm.Register(&Task{
+		Name:         "lint",
+		Dependencies: []string{"clean"},
+		Action:       record("lint"),
+	}))
+	require.NoError(t, tm.Register(&Task{
+		Name:         "test",
+		Dependencies: []string{"clean"},
+		Action:       record("test"),
+	}))
+	require.NoError(t, tm.Register(&Task{
+		Name:         "build",
+		Dependencies: []string{"clean", "lint", "test"},
+		Action:       record("build"),
+	}))
+	require.NoError(t, tm.Register(&Task{
+		Name:         "deploy",
+		Dependencies: []string{"build"},
+		Action:       record("deploy"),
+	}))
+}
+
+func TestPlan_Levels(t *testing.T) {
+	tm := NewTaskManager()
+	var ran []string
+	registerPipeline(t, tm, &ran)
+
+	plan, err := tm.Plan("build")
+	require.NoError(t, err)
+	require.Empty(t, ran, "planning must not run any action")
+	require.Equal(t, [][]string{
+		{"clean"},
+		{"lint", "test"},
+		{"build"},
+	}, plan.Levels)
+
+	var buf bytes.Buffer
+	require.NoError(t, plan.WriteText(&buf))
+	require.Equal(
+		t,
+		"Execution plan for build (4 tasks, 3 levels):\n"+
+			"  1. clean\n"+
+			"  2. lint, test (independent)\n"+
+			"  3. build\n",
+		buf.String(),
+	)
+}
+
+func TestPlan_MultipleTargets(t *testing.T) {
+	tm := NewTaskManager()
+	var ran []string
+	registerPipeline(t, tm, &ran)
+
+	plan, err := tm.Plan("lint", "deploy")
+	require.NoError(t, err)
+	require.Equal(t, [][]string{
+		{"clean"},
+		{"lint"},
+		{"test"},
+		{"build"},
+		{"deploy"},
+	}, plan.Levels)
+	require.Equal(t, "deploy", plan.Steps[2].Target)
+
+	var buf bytes.Buffer
+	require.NoError(t, plan.WriteJSON(&buf))
+	var decoded struct {
+		Targets []string `json:"targets"`
+		Tasks   []struct {
+			Name  string `json:"name"`
+			Level int    `json:"level"`
+		} `json:"tasks"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	require.Equal(t, []string{"lint", "deploy"}, decoded.Targets)
+	require.Len(t, decoded.Tasks, 5)
+	require.Equal(t, "deploy", decoded.Tasks[4].Name)
+	require.Equal(t, 5, decoded.Tasks[4].Level)
+}
+
+func TestPlan_UnknownTask(t *testing.T) {
+	tm := NewTaskManager()
+	require.NoError(t, tm.Register(&Task{
+		Name:         "build",
+		Dependencies: []string{"generate"},
+	}))
+
+	_, err := tm.Plan("build")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "task 'build' depends on unknown task 'generate'")
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package core
+
+import (
+	"os/exec"
+	"time"
+)
+
+// setProcessGroup() is a no-op on platforms without process groups; the
+// default cancellation kills the shell process itself, as there is no
+// signal to ask it to terminate.
+func setProcessGroup(cmd *exec.Cmd, grace time.Duration) {}
@@ -0,0 +1,28 @@
+//go:build unix
+
+package core
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// setProcessGroup() starts cmd in a new process group and makes context
+// cancellation stop the entire group rather than just the shell. The group
+// receives SIGTERM first and SIGKILL only if it is still running once the
+// grace period has passed.
+func setProcessGroup(cmd *exec.Cmd, grace time.Duration) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		pgid := -cmd.Process.Pid
+		if err := syscall.Kill(pgid, syscall.SIGTERM); err != nil {
+			return err
+		}
+		time.AfterFunc(grace, func() {
+			// The group is gone if every process exited in time
+			_ = syscall.Kill(pgid, syscall.SIGKILL)
+		})
+		return nil
+	}
+}
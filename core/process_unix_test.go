@@ -0,0 +1,121 @@
+//go:build unix
+
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunContext_CancelKillsProcessGroup(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "child.pid")
+
+	tm := NewTaskManager()
+	require.NoError(t, tm.Register(NewTaskFromConfig("hang", TaskConfig{
+		Command: "sleep 30 & echo $! > " + pidFile + "; wait",
+	})))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		require.Eventually(t, func() bool {
+			_, err := os.Stat(pidFile)
+			return err == nil
+		}, 5*time.Second, 10*time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	_, err := tm.RunContext(ctx, []string{"hang"}, RunOptions{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "run interrupted")
+	require.Less(t, time.Since(start), 10*time.Second)
+
+	data, err := os.ReadFile(pidFile)
+	require.NoError(t, err)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	require.NoError(t, err)
+
+	// The background child belongs to the killed group as well
+	require.Eventually(t, func() bool {
+		return syscall.Kill(pid, 0) == syscall.ESRCH
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestRunContext_GracePeriod(t *testing.T) {
+	dir := t.TempDir()
+	ready := filepath.Join(dir, "ready")
+	stopped := filepath.Join(dir, "stopped")
+
+	tm := NewTaskManager()
+	require.NoError(t, tm.Register(NewTaskFromConfig("server", TaskConfig{
+		Command: "trap 'echo > " + stopped + "; exit 0' TERM; " +
+			"echo > " + ready + "; while true; do sleep 0.1; done",
+		GracePeriod: 5,
+	})))
+	require.NoError(t, tm.Register(NewTaskFromConfig("stubborn", TaskConfig{
+		Command: "trap '' TERM; echo > " + ready +
+			"; while true; do sleep 0.1; done",
+		GracePeriod: 1,
+	})))
+
+	run := func(name string) time.Duration {
+		require.NoError(t, os.RemoveAll(ready))
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			require.Eventually(t, func() bool {
+				_, err := os.Stat(ready)
+				return err == nil
+			}, 5*time.Second, 10*time.Millisecond)
+			cancel()
+		}()
+
+		start := time.Now()
+		_, err := tm.RunContext(ctx, []string{name}, RunOptions{})
+		require.Error(t, err)
+		return time.Since(start)
+	}
+
+	// The command is asked to terminate and gets to clean up
+	run("server")
+	require.FileExists(t, stopped)
+
+	// A command ignoring SIGTERM is killed once the grace period is over
+	elapsed := run("stubborn")
+	require.GreaterOrEqual(t, elapsed, time.Second)
+	require.Less(t, elapsed, 5*time.Second)
+}
+
+func TestRunContext_ServiceDefaultGracePeriod(t *testing.T) {
+	dir := t.TempDir()
+	ready := filepath.Join(dir, "ready")
+	stopped := filepath.Join(dir, "stopped")
+
+	// A service without a grace period still gets to shut down cleanly
+	tm := NewTaskManager()
+	require.NoError(t, tm.Register(NewTaskFromConfig("server", TaskConfig{
+		Command: "trap 'sleep 0.2; echo > " + stopped + "; exit 0' TERM; " +
+			"echo > " + ready + "; while true; do sleep 0.1; done",
+		Service: true,
+	})))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		require.Eventually(t, func() bool {
+			_, err := os.Stat(ready)
+			return err == nil
+		}, 5*time.Second, 10*time.Millisecond)
+		cancel()
+	}()
+
+	_, err := tm.RunContext(ctx, []string{"server"}, RunOptions{})
+	require.Error(t, err)
+	require.FileExists(t, stopped)
+}
@@ -0,0 +1,177 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func runReportGraph(t *testing.T) ([]*RunResult, error) {
+	t.Helper()
+	tm := NewTaskManager()
+	require.NoError(t, tm.Register(NewTaskFromConfig("lint", TaskConfig{
+		Command: "echo linting",
+	})))
+	require.NoError(t, tm.Register(NewTaskFromConfig("test", TaskConfig{
+		Command: "echo testing; exit 3",
+		Depends: []string{"lint"},
+	})))
+	require.NoError(t, tm.Register(NewTaskFromConfig("deploy", TaskConfig{
+		Command: "echo deploying",
+		Depends: []string{"test"},
+	})))
+
+	results, err := tm.RunContext(
+		context.Background(),
+		[]string{"deploy"},
+		RunOptions{CaptureOutput: true},
+	)
+	require.Error(t, err)
+	return results, err
+}
+
+func TestRunContext_Results(t *testing.T) {
+	results, _ := runReportGraph(t)
+	require.Len(t, results, 3)
+
+	lint, test, deploy := results[0], results[1], results[2]
+	require.Equal(t, "lint", lint.Task)
+	require.Equal(t, StatusOK, lint.Status)
+	require.Equal(t, 0, lint.ExitCode)
+	require.Equal(t, "linting\n", lint.Output)
+	require.False(t, lint.Start.IsZero())
+	require.Equal(t, lint.End.Sub(lint.Start), lint.Duration)
+
+	require.Equal(t, StatusFailed, test.Status)
+	require.Equal(t, 3, test.ExitCode)
+	require.Equal(t, "testing\n", test.Output)
+	require.Error(t, test.Err)
+
+	require.Equal(t, StatusSkipped, deploy.Status)
+	require.Equal(t, -1, deploy.ExitCode)
+	require.True(t, deploy.Start.IsZero())
+}
+
+func TestRunContext_OutputNotCaptured(t *testing.T) {
+	// Without capturing, tasks write to groolp's own stdout and stderr,
+	// so that commands can detect a terminal
+	tm := NewTaskManager()
+	require.NoError(t, tm.Register(&Task{
+		Name: "build",
+		Action: func(ctx context.Context) error {
+			require.Same(t, os.Stdout, TaskStdout(ctx))
+			require.Same(t, os.Stderr, TaskStderr(ctx))
+			return nil
+		},
+	}))
+
+	results, err := tm.RunContext(
+		context.Background(),
+		[]string{"build"},
+		RunOptions{},
+	)
+	require.NoError(t, err)
+	require.Empty(t, results[0].Output)
+}
+
+func TestRunContext_ServiceOutputNotCaptured(t *testing.T) {
+	tm := NewTaskManager()
+	require.NoError(t, tm.Register(&Task{
+		Name:    "serve",
+		Service: true,
+		Action: func(ctx context.Context) error {
+			require.Same(t, os.Stdout, TaskStdout(ctx))
+			return nil
+		},
+	}))
+
+	results, err := tm.RunContext(
+		context.Background(),
+		[]string{"serve"},
+		RunOptions{CaptureOutput: true},
+	)
+	require.NoError(t, err)
+	require.Empty(t, results[0].Output)
+}
+
+func TestWriteReport_JSON(t *testing.T) {
+	results, runErr := runReportGraph(t)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteReport(&buf, ReportJSON, results, runErr))
+
+	var report struct {
+		Status string `json:"status"`
+		Tasks  []struct {
+			Name     string `json:"name"`
+			Status   string `json:"status"`
+			ExitCode int    `json:"exit_code"`
+			Output   string `json:"output"`
+		} `json:"tasks"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &report))
+	require.Equal(t, "failed", report.Status)
+	require.Len(t, report.Tasks, 3)
+	require.Equal(t, "test", report.Tasks[1].Name)
+	require.Equal(t, "failed", report.Tasks[1].Status)
+	require.Equal(t, 3, report.Tasks[1].ExitCode)
+	require.Equal(t, "testing\n", report.Tasks[1].Output)
+}
+
+func TestWriteReport_JUnit(t *testing.T) {
+	results, runErr := runReportGraph(t)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteReport(&buf, ReportJUnit, results, runErr))
+
+	var report junitTestSuites
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &report))
+	require.Equal(t, 3, report.Tests)
+	require.Equal(t, 1, report.Failures)
+	require.Equal(t, 1, report.Skipped)
+	require.Len(t, report.Suites, 1)
+
+	cases := report.Suites[0].Cases
+	require.Len(t, cases, 3)
+	require.Nil(t, cases[0].Failure)
+	require.NotNil(t, cases[1].Failure)
+	require.NotNil(t, cases[2].Skipped)
+}
+
+func TestWriteReport_RunErrorWithoutTasks(t *testing.T) {
+	tm := NewTaskManager()
+	results, runErr := tm.RunContext(
+		context.Background(),
+		[]string{"missing"},
+		RunOptions{},
+	)
+	require.Error(t, runErr)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteReport(&buf, ReportJSON, results, runErr))
+	var report struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &report))
+	require.Equal(t, "failed", report.Status)
+	require.Contains(t, report.Error, "missing")
+
+	buf.Reset()
+	require.NoError(t, WriteReport(&buf, ReportJUnit, results, runErr))
+	var junit junitTestSuites
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &junit))
+	require.Equal(t, 1, junit.Tests)
+	require.Equal(t, 1, junit.Failures)
+	require.Contains(t, junit.Suites[0].Cases[0].Failure.Message, "missing")
+}
+
+func TestWriteReport_UnknownFormat(t *testing.T) {
+	err := WriteReport(&bytes.Buffer{}, "yaml", nil, nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,165 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// TaskStatus describes the outcome of a task in a run
+type TaskStatus string
+
+const (
+	// StatusOK means the task's action completed successfully
+	StatusOK TaskStatus = "ok"
+	// StatusFailed means the task's action returned an error
+	StatusFailed TaskStatus = "failed"
+	// StatusSkipped means the task was never started because the run
+	// stopped before its dependencies completed
+	StatusSkipped TaskStatus = "skipped"
+	// StatusCached means the task was up to date and did not run
+	StatusCached TaskStatus = "cached"
+)
+
+// RunResult holds the outcome of a single task in a run
+type RunResult struct {
+	Task     string
+	Status   TaskStatus
+	Start    time.Time
+	End      time.Time
+	Duration time.Duration
+	// ExitCode is the exit status of a failed shell command, 1 for other
+	// failures, 0 for tasks that succeeded and -1 for tasks that never ran
+	ExitCode int
+	// Output is everything the task wrote to its stdout and stderr
+	Output string
+	Err    error
+	// AllowedFailure is set when the task failed but allows failure, so
+	// the run carried on as if it had succeeded
+	AllowedFailure bool
+}
+
+func newRunResult(task *Task) *RunResult {
+	return &RunResult{
+		Task:     task.Name,
+		Status:   StatusSkipped,
+		ExitCode: -1,
+	}
+}
+
+// finish() records the end of the task and derives status and exit code
+func (r *RunResult) finish(err error) {
+	r.End = time.Now()
+	r.Duration = r.End.Sub(r.Start)
+	r.Err = err
+	if err == nil {
+		r.Status = StatusOK
+		r.ExitCode = 0
+		return
+	}
+
+	r.Status = StatusFailed
+	r.ExitCode = 1
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+		r.ExitCode = exitErr.ExitCode()
+	}
+}
+
+type taskOutputKey struct{}
+
+type taskOutput struct {
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// TaskStdout() returns the writer a task action should use for its
+// standard output so that the output can be captured in its RunResult.
+func TaskStdout(ctx context.Context) io.Writer {
+	if out, ok := ctx.Value(taskOutputKey{}).(*taskOutput); ok {
+		return out.stdout
+	}
+	return os.Stdout
+}
+
+// TaskStderr() returns the writer a task action should use for its
+// standard error.
+func TaskStderr(ctx context.Context) io.Writer {
+	if out, ok := ctx.Value(taskOutputKey{}).(*taskOutput); ok {
+		return out.stderr
+	}
+	return os.Stderr
+}
+
+// withCapturedOutput() tees the task's stdout and stderr into buf
+func withCapturedOutput(
+	ctx context.Context,
+	buf *syncBuffer,
+) context.Context {
+	return context.WithValue(ctx, taskOutputKey{}, &taskOutput{
+		stdout: io.MultiWriter(os.Stdout, buf),
+		stderr: io.MultiWriter(os.Stderr, buf),
+	})
+}
+
+// syncBuffer is a bytes.Buffer that can be written to concurrently
+type syncBuffer struct {
+	buf bytes.Buffer
+	mu  sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+type taskDirKey struct{}
+
+// TaskDir() returns the working directory a task action should run its
+// commands in; empty means the current directory.
+func TaskDir(ctx context.Context) string {
+	dir, _ := ctx.Value(taskDirKey{}).(string)
+	return dir
+}
+
+func withTaskDir(ctx context.Context, dir string) context.Context {
+	return context.WithValue(ctx, taskDirKey{}, dir)
+}
+
+type taskEnvKey struct{}
+
+// TaskEnv() returns the environment variables, as KEY=value pairs, that
+// commands of the running task get in addition to those of groolp
+func TaskEnv(ctx context.Context) []string {
+	env, _ := ctx.Value(taskEnvKey{}).([]string)
+	return env
+}
+
+func withTaskEnv(ctx context.Context, env []string) context.Context {
+	return context.WithValue(ctx, taskEnvKey{}, env)
+}
+
+type gracePeriodKey struct{}
+
+// gracePeriod() returns how long commands of the running task get to exit
+// after being asked to stop before they are killed
+func gracePeriod(ctx context.Context) time.Duration {
+	grace, _ := ctx.Value(gracePeriodKey{}).(time.Duration)
+	return grace
+}
+
+func withGracePeriod(ctx context.Context, grace time.Duration) context.Context {
+	return context.WithValue(ctx, gracePeriodKey{}, grace)
+}
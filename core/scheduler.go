@@ -0,0 +1,318 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// RunOptions controls how a task graph is executed
+type RunOptions struct {
+	// Jobs is the maximum number of tasks that may run at the same time.
+	// Values below 1 are treated as 1.
+	Jobs int
+	// Force runs tasks even when their inputs are unchanged
+	Force bool
+	// KeepGoing keeps running every branch of the graph that does not
+	// depend on a failed task instead of stopping at the first failure
+	KeepGoing bool
+	// Params holds parameter values given on the command line; each value
+	// is passed to every task that declares a parameter of that name
+	Params map[string]string
+	// CaptureOutput records each task's output in its RunResult, e.g. for
+	// a report. Otherwise tasks write straight to groolp's stdout and
+	// stderr, so that they can tell when they run in a terminal.
+	CaptureOutput bool
+}
+
+// TaskError reports the failure of a task's action
+type TaskError struct {
+	Task string
+	Err  error
+}
+
+func (e *TaskError) Error() string {
+	return fmt.Sprintf("task '%s' failed: %v", e.Task, e.Err)
+}
+
+func (e *TaskError) Unwrap() error {
+	return e.Err
+}
+
+// runSession tracks the tasks that completed or failed across all targets
+// of a single invocation, so that shared dependencies run only once.
+type runSession struct {
+	executed map[string]bool
+	failed   map[string]bool
+	// params holds the resolved parameter values of each task
+	params map[string]map[string]string
+}
+
+func newRunSession() *runSession {
+	return &runSession{
+		executed: make(map[string]bool),
+		failed:   make(map[string]bool),
+		params:   make(map[string]map[string]string),
+	}
+}
+
+// taskGraph is the part of the registry reachable from a run target
+type taskGraph struct {
+	// order lists the tasks dependencies-first, in declaration order
+	order []*Task
+	// deps and dependents hold de-duplicated edges between graph tasks
+	deps       map[string][]string
+	dependents map[string][]string
+}
+
+// buildGraph() resolves the DAG rooted at taskName once, leaving out
+// tasks that have already been executed in this session. Tasks that
+// failed earlier in the session are left out as well, but edges to them
+// are kept so that their dependents never become ready.
+func (tm *TaskManager) buildGraph(
+	taskName string,
+	session *runSession,
+) (*taskGraph, error) {
+	if _, err := tm.retrieveAndCheck(taskName, nil); err != nil {
+		return nil, err
+	}
+
+	g := &taskGraph{
+		deps:       make(map[string][]string),
+		dependents: make(map[string][]string),
+	}
+	visited := make(map[string]bool)
+
+	// The whole subtree was checked above, so every name resolves here
+	var visit func(name string)
+	visit = func(name string) {
+		if visited[name] || session.executed[name] || session.failed[name] {
+			return
+		}
+		visited[name] = true
+
+		tm.mu.Lock()
+		task := tm.tasks[name]
+		tm.mu.Unlock()
+
+		seen := make(map[string]bool)
+		for _, dep := range task.Dependencies {
+			visit(dep)
+			if seen[dep] || session.executed[dep] {
+				continue
+			}
+			seen[dep] = true
+			g.deps[name] = append(g.deps[name], dep)
+			g.dependents[dep] = append(g.dependents[dep], name)
+		}
+
+		g.order = append(g.order, task)
+	}
+
+	visit(taskName)
+	return g, nil
+}
+
+// runGraph() executes every task in the graph, starting a task as soon as
+// all of its dependencies have finished, with at most jobs tasks running
+// at once. Once a task fails or ctx is cancelled no new tasks are started;
+// tasks that are already running are waited for and the first error is
+// returned. With opts.KeepGoing only the dependents of a failed task are
+// held back and all failures are returned together. Failures of tasks
+// that allow failure never stop the run. A result is returned for every
+// task in the graph, in graph order.
+func (tm *TaskManager) runGraph(
+	ctx context.Context,
+	g *taskGraph,
+	opts RunOptions,
+	session *runSession,
+) ([]*RunResult, error) {
+	jobs := opts.Jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	pending := make(map[string]int, len(g.order))
+	results := make([]*RunResult, len(g.order))
+	resultOf := make(map[string]*RunResult, len(g.order))
+	for i, task := range g.order {
+		pending[task.Name] = len(g.deps[task.Name])
+		results[i] = newRunResult(task)
+		resultOf[task.Name] = results[i]
+	}
+
+	type taskDone struct {
+		task *Task
+		err  error
+	}
+	doneCh := make(chan taskDone)
+	started := make(map[string]bool, len(g.order))
+	running := 0
+
+	var failures []error
+	for {
+		stopped := len(failures) > 0 && !opts.KeepGoing
+		for !stopped && ctx.Err() == nil && running < jobs {
+			task := nextReady(g.order, pending, started)
+			if task == nil {
+				break
+			}
+			started[task.Name] = true
+			running++
+
+			go func(task *Task, res *RunResult) {
+				taskCtx := withParams(ctx, session.params[task.Name])
+				taskCtx = withTaskDir(taskCtx, task.Dir)
+				taskCtx = withGracePeriod(taskCtx, task.EffectiveGracePeriod())
+				doneCh <- taskDone{
+					task: task,
+					err:  tm.executeTask(taskCtx, task, opts, res),
+				}
+			}(task, resultOf[task.Name])
+		}
+
+		if running == 0 {
+			if err := ctx.Err(); err != nil {
+				return results, fmt.Errorf("run interrupted: %w", err)
+			}
+			if len(failures) == 0 {
+				return results, nil
+			}
+			return results, errors.Join(failures...)
+		}
+
+		done := <-doneCh
+		running--
+		if done.err != nil {
+			if !done.task.AllowFailure {
+				session.failed[done.task.Name] = true
+				failures = append(failures, &TaskError{
+					Task: done.task.Name,
+					Err:  done.err,
+				})
+				continue
+			}
+			log.Printf(
+				"Task %s failed, continuing since failure is allowed: %v\n",
+				done.task.Name,
+				done.err,
+			)
+			resultOf[done.task.Name].AllowedFailure = true
+		}
+
+		session.executed[done.task.Name] = true
+		for _, dependent := range g.dependents[done.task.Name] {
+			pending[dependent]--
+		}
+	}
+}
+
+// executeTask() runs a single task's action, bounded by the task's
+// timeout, and records its outcome in res. A task with a lock waits for it
+// first; the wait counts neither as run time nor against the timeout.
+// Tasks that declare inputs are skipped when the inputs hash matches the
+// last successful run and all declared outputs still exist. Services
+// always run, as they are started rather than built.
+func (tm *TaskManager) executeTask(
+	ctx context.Context,
+	task *Task,
+	opts RunOptions,
+	res *RunResult,
+) error {
+	if task.Lock != nil {
+		if err := task.Lock.lock(ctx); err != nil {
+			res.Start = time.Now()
+			res.finish(err)
+			return err
+		}
+		defer task.Lock.unlock()
+	}
+	res.Start = time.Now()
+
+	var hash string
+	if tm.cache != nil && len(task.Inputs) > 0 && !task.Service {
+		var err error
+		if hash, err = hashInputs(task, TaskParams(ctx)); err != nil {
+			err = fmt.Errorf("failed to hash inputs: %w", err)
+			res.finish(err)
+			return err
+		}
+		if !opts.Force &&
+			hash == tm.cache.get(task.Name) &&
+			outputsExist(task) {
+			log.Printf("Skipping task: %s (up to date)\n", task.Name)
+			res.finish(nil)
+			res.Status = StatusCached
+			return nil
+		}
+	}
+
+	log.Printf("Running task: %s\n", task.Name)
+	// Services run for as long as they are needed, so their output would
+	// pile up in memory
+	capture := opts.CaptureOutput && !task.Service
+	err := tm.runAction(ctx, task, capture, res)
+	res.finish(err)
+	if err != nil {
+		return err
+	}
+
+	if hash != "" {
+		tm.cache.set(task.Name, hash)
+	}
+	return nil
+}
+
+// runAction() calls the task's action, with its output captured into res
+// if capture is set
+func (tm *TaskManager) runAction(
+	ctx context.Context,
+	task *Task,
+	capture bool,
+	res *RunResult,
+) error {
+	if task.Action == nil {
+		return nil
+	}
+
+	taskCtx := ctx
+	if capture {
+		output := &syncBuffer{}
+		defer func() {
+			res.Output = output.String()
+		}()
+		taskCtx = withCapturedOutput(ctx, output)
+	}
+	if task.Timeout > 0 {
+		var cancel context.CancelFunc
+		taskCtx, cancel = context.WithTimeout(taskCtx, task.Timeout)
+		defer cancel()
+	}
+
+	if err := task.Action(taskCtx); err != nil {
+		if ctx.Err() == nil &&
+			errors.Is(taskCtx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("timed out after %s: %w", task.Timeout, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// nextReady() returns the first task in order whose dependencies are done
+// and which has not been started yet. Picking tasks in graph order keeps
+// execution identical to a depth-first walk when only one job is allowed.
+func nextReady(
+	order []*Task,
+	pending map[string]int,
+	started map[string]bool,
+) *Task {
+	for _, task := range order {
+		if !started[task.Name] && pending[task.Name] == 0 {
+			return task
+		}
+	}
+	return nil
+}
@@ -0,0 +1,378 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunContext_ParallelIndependentTasks(t *testing.T) {
+	tm := NewTaskManager()
+
+	// lint and test can only both pass the barrier if they run together
+	var barrier sync.WaitGroup
+	barrier.Add(2)
+	waitForPeer := func(ctx context.Context) error {
+		barrier.Done()
+		ch := make(chan struct{})
+		go func() {
+			barrier.Wait()
+			close(ch)
+		}()
+		select {
+		case <-ch:
+			return nil
+		case <-time.After(2 * time.Second):
+			return errors.New("peer task did not run concurrently")
+		}
+	}
+
+	var ciRan bool
+	require.NoError(t, tm.Register(&Task{Name: "lint", Action: waitForPeer}))
+	require.NoError(t, tm.Register(&Task{Name: "test", Action: waitForPeer}))
+	require.NoError(t, tm.Register(&Task{
+		Name:         "ci",
+		Dependencies: []string{"lint", "test"},
+		Action: func(ctx context.Context) error {
+			ciRan = true
+			return nil
+		},
+	}))
+
+	_, err := tm.RunContext(
+		context.Background(),
+		[]string{"ci"},
+		RunOptions{Jobs: 2},
+	)
+	require.NoError(t, err)
+	require.True(t, ciRan)
+}
+
+func TestRunContext_JobsLimit(t *testing.T) {
+	tm := NewTaskManager()
+
+	var current, peak int32
+	action := func(ctx context.Context) error {
+		n := atomic.AddInt32(&current, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&current, -1)
+		return nil
+	}
+
+	deps := []string{}
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		require.NoError(t, tm.Register(&Task{Name: name, Action: action}))
+		deps = append(deps, name)
+	}
+	require.NoError(t, tm.Register(&Task{
+		Name:         "all",
+		Dependencies: deps,
+		Action:       func(ctx context.Context) error { return nil },
+	}))
+
+	_, err := tm.RunContext(
+		context.Background(),
+		[]string{"all"},
+		RunOptions{Jobs: 2},
+	)
+	require.NoError(t, err)
+	require.LessOrEqual(t, atomic.LoadInt32(&peak), int32(2))
+}
+
+func TestRunContext_SequentialOrder(t *testing.T) {
+	tm := NewTaskManager()
+
+	var order []string
+	record := func(name string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			order = append(order, name)
+			return nil
+		}
+	}
+
+	require.NoError(t, tm.Register(&Task{Name: "clean", Action: record("clean")}))
+	require.NoError(t, tm.Register(&Task{
+		Name:         "lint",
+		Dependencies: []string{"clean"},
+		Action:       record("lint"),
+	}))
+	require.NoError(t, tm.Register(&Task{
+		Name:         "test",
+		Dependencies: []string{"clean"},
+		Action:       record("test"),
+	}))
+	require.NoError(t, tm.Register(&Task{
+		Name:         "build",
+		Dependencies: []string{"lint", "test", "clean"},
+		Action:       record("build"),
+	}))
+
+	_, err := tm.RunContext(
+		context.Background(),
+		[]string{"build"},
+		RunOptions{Jobs: 1},
+	)
+	require.NoError(t, err)
+	require.Equal(t, []string{"clean", "lint", "test", "build"}, order)
+}
+
+func TestRunContext_FailureStopsScheduling(t *testing.T) {
+	tm := NewTaskManager()
+
+	var deployRan bool
+	require.NoError(t, tm.Register(&Task{
+		Name: "test",
+		Action: func(ctx context.Context) error {
+			return errors.New("tests failed")
+		},
+	}))
+	require.NoError(t, tm.Register(&Task{
+		Name:         "deploy",
+		Dependencies: []string{"test"},
+		Action: func(ctx context.Context) error {
+			deployRan = true
+			return nil
+		},
+	}))
+
+	_, err := tm.RunContext(
+		context.Background(),
+		[]string{"deploy"},
+		RunOptions{Jobs: 4},
+	)
+	require.EqualError(t, err, "task 'test' failed: tests failed")
+	require.False(t, deployRan)
+}
+
+func TestRunContext_KeepGoing(t *testing.T) {
+	tm := NewTaskManager()
+
+	var mu sync.Mutex
+	ran := make(map[string]bool)
+	record := func(name string, err error) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			mu.Lock()
+			ran[name] = true
+			mu.Unlock()
+			return err
+		}
+	}
+
+	require.NoError(t, tm.Register(&Task{
+		Name:   "lint",
+		Action: record("lint", errors.New("lint failed")),
+	}))
+	require.NoError(t, tm.Register(&Task{
+		Name:   "vet",
+		Action: record("vet", errors.New("vet failed")),
+	}))
+	require.NoError(t, tm.Register(&Task{
+		Name:   "test",
+		Action: record("test", nil),
+	}))
+	require.NoError(t, tm.Register(&Task{
+		Name:         "package",
+		Dependencies: []string{"test"},
+		Action:       record("package", nil),
+	}))
+	require.NoError(t, tm.Register(&Task{
+		Name:         "release",
+		Dependencies: []string{"lint", "vet", "package"},
+		Action:       record("release", nil),
+	}))
+
+	results, err := tm.RunContext(
+		context.Background(),
+		[]string{"release"},
+		RunOptions{Jobs: 1, KeepGoing: true},
+	)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "task 'lint' failed: lint failed")
+	require.Contains(t, err.Error(), "task 'vet' failed: vet failed")
+
+	var taskErr *TaskError
+	require.ErrorAs(t, err, &taskErr)
+
+	require.True(t, ran["test"])
+	require.True(t, ran["package"])
+	require.False(t, ran["release"])
+
+	statuses := make(map[string]TaskStatus)
+	for _, res := range results {
+		statuses[res.Task] = res.Status
+	}
+	require.Equal(t, map[string]TaskStatus{
+		"lint":    StatusFailed,
+		"vet":     StatusFailed,
+		"test":    StatusOK,
+		"package": StatusOK,
+		"release": StatusSkipped,
+	}, statuses)
+}
+
+func TestRunContext_AllowFailure(t *testing.T) {
+	tm := NewTaskManager()
+
+	var buildRan bool
+	require.NoError(t, tm.Register(&Task{
+		Name:         "optional-lint",
+		AllowFailure: true,
+		Action: func(ctx context.Context) error {
+			return errors.New("linter not installed")
+		},
+	}))
+	require.NoError(t, tm.Register(&Task{
+		Name:         "build",
+		Dependencies: []string{"optional-lint"},
+		Action: func(ctx context.Context) error {
+			buildRan = true
+			return nil
+		},
+	}))
+
+	results, err := tm.RunContext(
+		context.Background(),
+		[]string{"build"},
+		RunOptions{},
+	)
+	require.NoError(t, err)
+	require.True(t, buildRan)
+	require.Equal(t, StatusFailed, results[0].Status)
+	require.True(t, results[0].AllowedFailure)
+	require.Equal(t, StatusOK, results[1].Status)
+}
+
+func TestRunContext_MultipleTargets(t *testing.T) {
+	tm := NewTaskManager()
+
+	var order []string
+	record := func(name string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			order = append(order, name)
+			return nil
+		}
+	}
+
+	require.NoError(t, tm.Register(&Task{Name: "clean", Action: record("clean")}))
+	require.NoError(t, tm.Register(&Task{
+		Name:         "lint",
+		Dependencies: []string{"clean"},
+		Action:       record("lint"),
+	}))
+	require.NoError(t, tm.Register(&Task{
+		Name:         "test",
+		Dependencies: []string{"clean"},
+		Action:       record("test"),
+	}))
+
+	results, err := tm.RunContext(
+		context.Background(),
+		[]string{"clean", "lint", "test"},
+		RunOptions{Jobs: 4},
+	)
+	require.NoError(t, err)
+	require.Equal(t, []string{"clean", "lint", "test"}, order)
+	require.Len(t, results, 3)
+
+	// An unknown target is reported before anything runs
+	order = nil
+	require.Error(t, tm.Run("clean", "tset"))
+	require.Empty(t, order)
+}
+
+func TestRunContext_MultipleTargetsKeepGoing(t *testing.T) {
+	tm := NewTaskManager()
+
+	runs := make(map[string]int)
+	record := func(name string, err error) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			runs[name]++
+			return err
+		}
+	}
+
+	require.NoError(t, tm.Register(&Task{
+		Name:   "generate",
+		Action: record("generate", errors.New("generator crashed")),
+	}))
+	require.NoError(t, tm.Register(&Task{
+		Name:         "build",
+		Dependencies: []string{"generate"},
+		Action:       record("build", nil),
+	}))
+	require.NoError(t, tm.Register(&Task{
+		Name:   "lint",
+		Action: record("lint", nil),
+	}))
+	require.NoError(t, tm.Register(&Task{
+		Name:         "test",
+		Dependencies: []string{"generate"},
+		Action:       record("test", nil),
+	}))
+
+	targets := []string{"build", "lint", "test"}
+
+	// Without --keep-going the remaining targets are abandoned
+	_, err := tm.RunContext(context.Background(), targets, RunOptions{})
+	require.Error(t, err)
+	require.Equal(t, map[string]int{"generate": 1}, runs)
+
+	runs = make(map[string]int)
+	results, err := tm.RunContext(
+		context.Background(),
+		targets,
+		RunOptions{KeepGoing: true},
+	)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "generator crashed")
+
+	// The failed shared dependency is not retried for the later target
+	require.Equal(t, map[string]int{"generate": 1, "lint": 1}, runs)
+
+	statuses := make(map[string]TaskStatus)
+	for _, res := range results {
+		statuses[res.Task] = res.Status
+	}
+	require.Equal(t, map[string]TaskStatus{
+		"generate": StatusFailed,
+		"build":    StatusSkipped,
+		"lint":     StatusOK,
+		"test":     StatusSkipped,
+	}, statuses)
+}
+
+func TestRunContext_LockWaitIsNotRunTime(t *testing.T) {
+	tm := NewTaskManager()
+	lock := NewTaskLock()
+
+	// Another task holds the lock for longer than the timeout; the clock
+	// only starts once the task gets the lock
+	require.NoError(t, lock.lock(context.Background()))
+	time.AfterFunc(300*time.Millisecond, lock.unlock)
+
+	require.NoError(t, tm.Register(&Task{
+		Name:    "quick",
+		Lock:    lock,
+		Timeout: 100 * time.Millisecond,
+		Action:  func(ctx context.Context) error { return nil },
+	}))
+
+	results, err := tm.RunContext(
+		context.Background(),
+		[]string{"quick"},
+		RunOptions{},
+	)
+	require.NoError(t, err)
+	require.Less(t, results[0].Duration, 100*time.Millisecond)
+}
@@ -0,0 +1,38 @@
+package core
+
+import (
+	"context"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// ShellCommand() prepares cmdString to run through the platform shell.
+// The command runs in its own process group, which is stopped as a whole
+// when ctx is cancelled, so no stray child processes are left behind. The
+// group is first asked to terminate and only killed once the running
+// task's grace period is over. Background processes that keep the output
+// pipes open do not block the command from completing for longer than a
+// second after that.
+func ShellCommand(ctx context.Context, cmdString string) *exec.Cmd {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd.exe", "/c", cmdString)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", cmdString)
+	}
+	grace := gracePeriod(ctx)
+	setProcessGroup(cmd, grace)
+	cmd.WaitDelay = grace + time.Second
+	return cmd
+}
+
+// shellQuote() quotes s as a single literal argument for the platform
+// shell
+func shellQuote(s string) string {
+	if runtime.GOOS == "windows" {
+		return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
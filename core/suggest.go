@@ -0,0 +1,122 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxSuggestions caps the number of names offered for an unknown task
+const maxSuggestions = 3
+
+// Suggest() returns the registered task names closest to name, best match
+// first, for "did you mean" hints. It returns nothing if no task name is
+// close enough.
+func (tm *TaskManager) Suggest(name string) []string {
+	tm.mu.Lock()
+	names := make([]string, 0, len(tm.tasks))
+	for taskName := range tm.tasks {
+		names = append(names, taskName)
+	}
+	tm.mu.Unlock()
+
+	return suggestNames(name, names)
+}
+
+// suggestNames() picks the candidates within an edit distance of about a
+// third of the length of name. Case is ignored, and swapping two adjacent
+// characters counts as a single edit.
+func suggestNames(name string, candidates []string) []string {
+	maxDistance := len([]rune(name)) / 3
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+
+	type match struct {
+		name     string
+		distance int
+	}
+	var matches []match
+	for _, candidate := range candidates {
+		if candidate == name {
+			continue
+		}
+		d := editDistance(strings.ToLower(name), strings.ToLower(candidate))
+		if d <= maxDistance {
+			matches = append(matches, match{candidate, d})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].name < matches[j].name
+	})
+
+	var suggestions []string
+	for i := 0; i < len(matches) && i < maxSuggestions; i++ {
+		suggestions = append(suggestions, matches[i].name)
+	}
+	return suggestions
+}
+
+// editDistance() returns the optimal string alignment distance between a
+// and b: the number of insertions, deletions, substitutions and swaps of
+// adjacent characters needed to turn one into the other
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	// d[i][j] is the distance between the first i runes of s and the
+	// first j runes of t
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d[i][j] = min3(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				if swap := d[i-2][j-2] + 1; swap < d[i][j] {
+					d[i][j] = swap
+				}
+			}
+		}
+	}
+	return d[len(s)][len(t)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// didYouMean() formats suggestions as a hint to append to an error
+// message, e.g. " (did you mean 'build' or 'bundle'?)"
+func didYouMean(suggestions []string) string {
+	if len(suggestions) == 0 {
+		return ""
+	}
+
+	quoted := make([]string, len(suggestions))
+	for i, s := range suggestions {
+		quoted[i] = fmt.Sprintf("'%s'", s)
+	}
+	hint := quoted[len(quoted)-1]
+	if len(quoted) > 1 {
+		hint = strings.Join(quoted[:len(quoted)-1], ", ") + " or " + hint
+	}
+	return fmt.Sprintf(" (did you mean %s?)", hint)
+}
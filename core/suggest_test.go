@@ -0,0 +1,71 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEditDistance(t *testing.T) {
+	for _, tc := range []struct {
+		a, b     string
+		expected int
+	}{
+		{"build", "build", 0},
+		{"bild", "build", 1},
+		{"biuld", "build", 1},
+		{"test", "tset", 1},
+		{"lint", "list", 1},
+		{"deploy", "clean", 6},
+		{"", "test", 4},
+	} {
+		require.Equal(t, tc.expected, editDistance(tc.a, tc.b), "%s/%s", tc.a, tc.b)
+	}
+}
+
+func TestSuggestNames(t *testing.T) {
+	names := []string{"build", "build-all", "bundle", "deploy", "test"}
+
+	require.Equal(t, []string{"build"}, suggestNames("biuld", names))
+	require.Equal(t, []string{"test"}, suggestNames("TEST", names))
+	require.Equal(t, []string{"deploy"}, suggestNames("depoly", names))
+	require.Empty(t, suggestNames("lint", names))
+	require.Empty(t, suggestNames("build", []string{"build"}))
+}
+
+func TestUnknownTaskSuggestions(t *testing.T) {
+	tm := NewTaskManager()
+	require.NoError(t, tm.Register(&Task{Name: "build"}))
+	require.NoError(t, tm.Register(&Task{Name: "lint"}))
+	require.NoError(t, tm.Register(&Task{Name: "list"}))
+	require.NoError(t, tm.Register(&Task{Name: "generate"}))
+	require.NoError(t, tm.Register(&Task{
+		Name:         "deploy",
+		Dependencies: []string{"genrate"},
+	}))
+
+	_, err := tm.RunContext(context.Background(), []string{"buidl"}, RunOptions{})
+	require.EqualError(t, err, "task 'buidl' not found (did you mean 'build'?)")
+
+	_, err = tm.RunContext(context.Background(), []string{"liit"}, RunOptions{})
+	require.EqualError(
+		t,
+		err,
+		"task 'liit' not found (did you mean 'lint' or 'list'?)",
+	)
+
+	_, err = tm.RunContext(context.Background(), []string{"deploy"}, RunOptions{})
+	require.EqualError(
+		t,
+		err,
+		"task 'deploy' depends on unknown task 'genrate' (did you mean 'generate'?)",
+	)
+
+	err = tm.Validate()
+	require.EqualError(
+		t,
+		err,
+		"task 'deploy' depends on unknown task 'genrate' (did you mean 'generate'?)",
+	)
+}
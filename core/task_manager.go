@@ -1,11 +1,16 @@
 package core
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
+	"sort"
+	"strings"
 	"sync"
+	"text/template"
+	"time"
 )
 
 // Task represents a single task with its dependencies and action
@@ -13,39 +18,208 @@ type Task struct {
 	Name         string
 	Description  string
 	Dependencies []string
-	Action       func() error
+	// Action performs the task's work. It must return promptly once ctx
+	// is cancelled, e.g. on timeout or interrupt.
+	Action func(ctx context.Context) error
+
+	// Command is the shell command of a task from tasks.yaml, before
+	// parameters are substituted; it is part of the inputs hash, so that
+	// changing it runs the task again
+	Command string
+
+	// Script is the Lua script a task from tasks.yaml runs after its
+	// command; like the command, its contents are part of the inputs hash
+	Script string
+
+	// Inputs and Outputs are glob patterns (with ** support). A task with
+	// inputs is skipped when none of the matched files changed since its
+	// last successful run and all of its outputs exist.
+	Inputs  []string
+	Outputs []string
+
+	// Watch lists file patterns that should trigger the task in watch mode
+	Watch []string
+
+	// Timeout limits how long the action may run; zero means no limit
+	Timeout time.Duration
+
+	// Service marks a long-running task such as a development server. In
+	// watch mode it runs in the background and is restarted on changes
+	// instead of blocking the watcher until it exits.
+	Service bool
+
+	// GracePeriod is how long the task's commands get to exit after being
+	// asked to stop (SIGTERM) before they are killed. Zero means
+	// DefaultServiceGracePeriod for services and no time at all for other
+	// tasks.
+	GracePeriod time.Duration
+
+	// AllowFailure makes a failure of this task non-blocking: dependents
+	// still run and the run as a whole does not fail because of it
+	AllowFailure bool
+
+	// Dir is the working directory of the task's commands; empty means
+	// the project root
+	Dir string
+
+	// Env and EnvFiles are the environment settings of a task from
+	// tasks.yaml, including the global ones: variables set for its
+	// commands and the dotenv files they are loaded from. They are read
+	// each time the task runs.
+	Env      map[string]string
+	EnvFiles []string
+
+	// Params declares the parameters the task accepts; their values are
+	// available to the action through TaskParams()
+	Params []Param
+
+	// Lock, if set, is shared with tasks that must not run at the same
+	// time as this one. The task waits for it before its run time and
+	// timeout start.
+	Lock *TaskLock
+
+	// Source is the file the task was defined in, i.e. tasks.yaml or a
+	// Lua script; it is empty for tasks registered directly in Go
+	Source string
 }
 
-func NewTaskFromConfig(
-	name string,
-	description string,
-	dependencies []string,
-	actionCmd string,
-) *Task {
+// DefaultServiceGracePeriod is the grace period of services that do not
+// set one, so that they always get a chance to shut down cleanly
+const DefaultServiceGracePeriod = 5 * time.Second
+
+// EffectiveGracePeriod() returns how long the task's commands get to exit
+// after being asked to stop
+func (t *Task) EffectiveGracePeriod() time.Duration {
+	if t.GracePeriod == 0 && t.Service {
+		return DefaultServiceGracePeriod
+	}
+	return t.GracePeriod
+}
+
+// NewTaskFromConfig() builds a task from its tasks.yaml definition. The
+// task's action runs the shell command, if any, and then the Lua script.
+// Parameters are substituted into the command, shell-quoted, only if the
+// task declares any; other commands run exactly as written. The environment is read from
+// the task's env files each time it runs, with its env map taking
+// precedence, and applies to the commands the script runs as well.
+func NewTaskFromConfig(name string, tc TaskConfig) *Task {
+	command, commandErr := parseCommand(name, tc)
+
 	return &Task{
 		Name:         name,
-		Description:  description,
-		Dependencies: dependencies,
-		Action: func() error {
-			cmd := exec.Command("sh", "-c", actionCmd)
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-			return cmd.Run()
+		Description:  tc.Description,
+		Command:      tc.command(),
+		Script:       tc.Script,
+		Dependencies: tc.dependencies(),
+		Inputs:       tc.Inputs,
+		Outputs:      tc.Outputs,
+		Watch:        tc.Watch,
+		Timeout:      time.Duration(tc.Timeout) * time.Second,
+		Service:      tc.Service,
+		GracePeriod:  time.Duration(tc.GracePeriod) * time.Second,
+		AllowFailure: tc.AllowFailure,
+		Params:       tc.Params,
+		Dir:          tc.Dir,
+		Env:          tc.Env,
+		EnvFiles:     tc.EnvFile,
+		Action: func(ctx context.Context) error {
+			if commandErr != nil {
+				return commandErr
+			}
+			env, err := tc.environ()
+			if err != nil {
+				return err
+			}
+			ctx = withTaskEnv(ctx, env)
+
+			if cmdString := tc.command(); cmdString != "" {
+				if command != nil {
+					var b strings.Builder
+					err := command.Execute(&b, quoteParams(TaskParams(ctx)))
+					if err != nil {
+						return fmt.Errorf(
+							"failed to substitute parameters: %w",
+							err,
+						)
+					}
+					cmdString = b.String()
+				}
+				cmd := ShellCommand(ctx, cmdString)
+				cmd.Dir = tc.Dir
+				cmd.Env = append(os.Environ(), env...)
+				cmd.Stdout = TaskStdout(ctx)
+				cmd.Stderr = TaskStderr(ctx)
+				if err := cmd.Run(); err != nil {
+					return err
+				}
+			}
+
+			if tc.Script != "" {
+				if ScriptRunner == nil {
+					return fmt.Errorf(
+						"cannot run script %s: no script runner available",
+						tc.Script,
+					)
+				}
+				return ScriptRunner(ctx, tc.Script)
+			}
+
+			return nil
 		},
 	}
 }
 
+// quoteParams() shell-quotes parameter values for substitution into a
+// command, so that a value is always a single argument to it and never
+// runs commands of its own
+func quoteParams(params map[string]string) map[string]string {
+	quoted := make(map[string]string, len(params))
+	for name, value := range params {
+		quoted[name] = shellQuote(value)
+	}
+	return quoted
+}
+
+// parseCommand() parses the shell command of a task that declares
+// parameters as a template, so that they can be substituted into it as
+// {{ .name }}. Commands of tasks without parameters are not templates:
+// they may well contain {{ }} meant for another tool, e.g. go list -f.
+func parseCommand(name string, tc TaskConfig) (*template.Template, error) {
+	command := tc.command()
+	if command == "" || len(tc.Params) == 0 {
+		return nil, nil
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(command)
+	if err != nil {
+		return nil, fmt.Errorf("invalid command: %w", err)
+	}
+	return tmpl, nil
+}
+
 // TaskManagerInterface defines the methods that TaskManager exposes
 type TaskManagerInterface interface {
 	Register(task *Task) error
-	Run(taskName string) error
+	Run(taskNames ...string) error
+	RunContext(
+		ctx context.Context,
+		taskNames []string,
+		opts RunOptions,
+	) ([]*RunResult, error)
 	ListTasks() []*Task
 }
 
 // TaskManager manages registration and execution of tasks
 type TaskManager struct {
 	tasks map[string]*Task
+	cache *TaskCache
 	mu    sync.Mutex
+
+	// duplicates holds tasks that were rejected by Register() because a
+	// task of the same name already existed, so Validate() can report them
+	duplicates []*Task
+	// loadErrors holds the errors of task definitions that failed to
+	// load, such as broken Lua scripts, so Validate() can report them
+	loadErrors []error
 }
 
 func NewTaskManager() *TaskManager {
@@ -54,12 +228,18 @@ func NewTaskManager() *TaskManager {
 	}
 }
 
+// SetCache() enables skipping of up-to-date tasks using the given cache
+func (tm *TaskManager) SetCache(cache *TaskCache) {
+	tm.cache = cache
+}
+
 // Register() adds a new task to the manager
 func (tm *TaskManager) Register(task *Task) error {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
 	if _, exists := tm.tasks[task.Name]; exists {
+		tm.duplicates = append(tm.duplicates, task)
 		return fmt.Errorf("task '%s' already exists", task.Name)
 	}
 	tm.tasks[task.Name] = task
@@ -67,40 +247,83 @@ func (tm *TaskManager) Register(task *Task) error {
 	return nil
 }
 
-// Run() executes tasks and its dependencies
-func (tm *TaskManager) Run(taskName string) error {
-	executed := make(map[string]bool)
-	return tm.runTask(taskName, executed)
+// RecordLoadError() notes that a file of task definitions, such as a Lua
+// script, failed to load, so that Validate() reports it
+func (tm *TaskManager) RecordLoadError(err error) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.loadErrors = append(tm.loadErrors, err)
 }
 
-func (tm *TaskManager) runTask(
-	taskName string,
-	executed map[string]bool,
-) error {
-	if executed[taskName] {
-		return nil
-	}
+// Run() executes the given tasks and their dependencies one at a time
+func (tm *TaskManager) Run(taskNames ...string) error {
+	_, err := tm.RunContext(context.Background(), taskNames, RunOptions{})
+	return err
+}
 
-	task, err := tm.retrieveAndCheck(taskName, nil)
+// RunContext() executes the given tasks and their dependencies. Targets
+// run one after another in the given order, while independent tasks
+// within a target's graph run concurrently up to opts.Jobs. Every task
+// runs at most once per invocation, even when several targets share it.
+// Cancelling ctx interrupts running tasks and stops the run. The returned
+// results cover every task that was scheduled, including those that were
+// skipped because the run stopped early.
+func (tm *TaskManager) RunContext(
+	ctx context.Context,
+	taskNames []string,
+	opts RunOptions,
+) ([]*RunResult, error) {
+	// Check every target and parameter up front so a typo in the last
+	// one does not surface only after the others have run
+	for _, taskName := range taskNames {
+		if _, err := tm.retrieveAndCheck(taskName, nil); err != nil {
+			return nil, err
+		}
+	}
+	params, err := tm.resolveParams(taskNames, opts.Params)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Make sure dependencies run first
-	for _, dep := range task.Dependencies {
-		if err := tm.runTask(dep, executed); err != nil {
-			return err
+	session := newRunSession()
+	session.params = params
+	var results []*RunResult
+	var failures []error
+	for _, taskName := range taskNames {
+		res, err := tm.runTask(ctx, taskName, opts, session)
+		results = append(results, res...)
+		if err != nil {
+			if ctx.Err() != nil || !opts.KeepGoing {
+				return results, err
+			}
+			failures = append(failures, err)
 		}
 	}
+	return results, errors.Join(failures...)
+}
 
-	// Execute the task
-	log.Printf("Running task: %s\n", task.Name)
-	if err := task.Action(); err != nil {
-		return err
+func (tm *TaskManager) runTask(
+	ctx context.Context,
+	taskName string,
+	opts RunOptions,
+	session *runSession,
+) ([]*RunResult, error) {
+	if session.executed[taskName] || session.failed[taskName] {
+		return nil, nil
 	}
 
-	executed[taskName] = true
-	return nil
+	g, err := tm.buildGraph(taskName, session)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := tm.runGraph(ctx, g, opts, session)
+	if tm.cache != nil {
+		if saveErr := tm.cache.Save(); saveErr != nil {
+			log.Printf("Warning: %v\n", saveErr)
+		}
+	}
+	return results, err
 }
 
 func (tm *TaskManager) retrieveAndCheck(
@@ -112,7 +335,10 @@ func (tm *TaskManager) retrieveAndCheck(
 	tm.mu.Unlock()
 
 	if !exists {
-		return nil, fmt.Errorf("task '%s' not found", taskName)
+		return nil, &UnknownTaskError{
+			Name:        taskName,
+			Suggestions: tm.Suggest(taskName),
+		}
 	}
 
 	if recStack == nil {
@@ -120,16 +346,27 @@ func (tm *TaskManager) retrieveAndCheck(
 	}
 
 	if recStack[taskName] {
-		return nil, fmt.Errorf(
+		return nil, &ConfigError{Err: fmt.Errorf(
 			"circular dependency detected on task '%s'",
 			taskName,
-		)
+		)}
 	}
 
 	recStack[taskName] = true
 
 	for _, dep := range task.Dependencies {
 		if _, err := tm.retrieveAndCheck(dep, recStack); err != nil {
+			// A missing dependency is a mistake in the task definitions
+			// rather than in the task names asked for
+			var unknown *UnknownTaskError
+			if errors.As(err, &unknown) && unknown.Name == dep {
+				return nil, &ConfigError{Err: fmt.Errorf(
+					"task '%s' depends on unknown task '%s'%s",
+					taskName,
+					dep,
+					didYouMean(unknown.Suggestions),
+				)}
+			}
 			return nil, err
 		}
 	}
@@ -139,6 +376,7 @@ func (tm *TaskManager) retrieveAndCheck(
 	return task, nil
 }
 
+// ListTasks() returns all registered tasks sorted by name
 func (tm *TaskManager) ListTasks() []*Task {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
@@ -147,6 +385,9 @@ func (tm *TaskManager) ListTasks() []*Task {
 	for _, task := range tm.tasks {
 		taskList = append(taskList, task)
 	}
+	sort.Slice(taskList, func(i, j int) bool {
+		return taskList[i].Name < taskList[j].Name
+	})
 
 	return taskList
 }
@@ -1,6 +1,8 @@
 package core
 
 import (
+	"context"
+	"errors"
 	"sync"
 	"testing"
 
@@ -13,7 +15,7 @@ func TestTaskRegistration(t *testing.T) {
 	task := &Task{
 		Name:        "test-task",
 		Description: "A test task",
-		Action: func() error {
+		Action: func(ctx context.Context) error {
 			return nil
 		},
 	}
@@ -35,7 +37,7 @@ func TestTaskExecution(t *testing.T) {
 	task := &Task{
 		Name:        "execute-task",
 		Description: "Executes a task",
-		Action: func() error {
+		Action: func(ctx context.Context) error {
 			executed = true
 			return nil
 		},
@@ -59,7 +61,7 @@ func TestTaskDependencies(t *testing.T) {
 	taskA := &Task{
 		Name:        "taskA",
 		Description: "Task A",
-		Action: func() error {
+		Action: func(ctx context.Context) error {
 			executionOrder = append(executionOrder, "taskA")
 			return nil
 		},
@@ -69,7 +71,7 @@ func TestTaskDependencies(t *testing.T) {
 		Name:         "taskB",
 		Description:  "Task B",
 		Dependencies: []string{"taskA"},
-		Action: func() error {
+		Action: func(ctx context.Context) error {
 			executionOrder = append(executionOrder, "taskB")
 			return nil
 		},
@@ -102,19 +104,19 @@ func TestRetrieveAndCheck(t *testing.T) {
 		Name:         "taskA",
 		Description:  "Task A",
 		Dependencies: []string{"taskB", "taskC"},
-		Action:       func() error { return nil },
+		Action:       func(ctx context.Context) error { return nil },
 	}
 	taskB := &Task{
 		Name:         "taskB",
 		Description:  "Task B",
 		Dependencies: []string{"taskC"},
-		Action:       func() error { return nil },
+		Action:       func(ctx context.Context) error { return nil },
 	}
 	taskC := &Task{
 		Name:         "taskC",
 		Description:  "Task C",
 		Dependencies: nil,
-		Action:       func() error { return nil },
+		Action:       func(ctx context.Context) error { return nil },
 	}
 	require.NoError(t, tm.Register(taskA))
 	require.NoError(t, tm.Register(taskB))
@@ -128,19 +130,19 @@ func TestRetrieveAndCheck(t *testing.T) {
 		Name:         "taskX",
 		Description:  "Task X",
 		Dependencies: []string{"taskY"},
-		Action:       func() error { return nil },
+		Action:       func(ctx context.Context) error { return nil },
 	}
 	taskY := &Task{
 		Name:         "taskY",
 		Description:  "Task Y",
 		Dependencies: []string{"taskZ"},
-		Action:       func() error { return nil },
+		Action:       func(ctx context.Context) error { return nil },
 	}
 	taskZ := &Task{
 		Name:         "taskZ",
 		Description:  "Task Z",
 		Dependencies: []string{"taskX"},
-		Action:       func() error { return nil },
+		Action:       func(ctx context.Context) error { return nil },
 	}
 	require.NoError(t, tm.Register(taskX))
 	require.NoError(t, tm.Register(taskY))
@@ -151,6 +153,42 @@ func TestRetrieveAndCheck(t *testing.T) {
 	require.Contains(t, err.Error(), "circular dependency detected")
 }
 
+func TestRunContext_ErrorTypes(t *testing.T) {
+	tm := NewTaskManager()
+	require.NoError(t, tm.Register(&Task{
+		Name:         "build",
+		Dependencies: []string{"generate"},
+	}))
+	require.NoError(t, tm.Register(&Task{
+		Name:   "test",
+		Params: []Param{{Name: "suite", Required: true}},
+		Action: func(ctx context.Context) error { return errors.New("boom") },
+	}))
+
+	var unknown *UnknownTaskError
+	_, err := tm.RunContext(context.Background(), []string{"deploy"}, RunOptions{})
+	require.ErrorAs(t, err, &unknown)
+	require.Equal(t, "deploy", unknown.Name)
+
+	var config *ConfigError
+	_, err = tm.RunContext(context.Background(), []string{"build"}, RunOptions{})
+	require.ErrorAs(t, err, &config)
+	require.EqualError(t, err, "task 'build' depends on unknown task 'generate'")
+
+	var param *ParamError
+	_, err = tm.RunContext(context.Background(), []string{"test"}, RunOptions{})
+	require.ErrorAs(t, err, &param)
+
+	var taskErr *TaskError
+	_, err = tm.RunContext(
+		context.Background(),
+		[]string{"test"},
+		RunOptions{Params: map[string]string{"suite": "unit"}},
+	)
+	require.ErrorAs(t, err, &taskErr)
+	require.Equal(t, "test", taskErr.Task)
+}
+
 func TestRunTask_ExecuteOnce(t *testing.T) {
 	tm := NewTaskManager()
 	var mu sync.Mutex
@@ -165,7 +203,7 @@ func TestRunTask_ExecuteOnce(t *testing.T) {
 		Name:         "clean",
 		Description:  "Clean task",
 		Dependencies: nil,
-		Action: func() error {
+		Action: func(ctx context.Context) error {
 			inc("clean")
 			return nil
 		},
@@ -174,7 +212,7 @@ func TestRunTask_ExecuteOnce(t *testing.T) {
 		Name:         "build",
 		Description:  "Build task",
 		Dependencies: []string{"clean"},
-		Action: func() error {
+		Action: func(ctx context.Context) error {
 			inc("build")
 			return nil
 		},
@@ -183,7 +221,7 @@ func TestRunTask_ExecuteOnce(t *testing.T) {
 		Name:         "test",
 		Description:  "Test task",
 		Dependencies: []string{"build"},
-		Action: func() error {
+		Action: func(ctx context.Context) error {
 			inc("test")
 			return nil
 		},
@@ -192,7 +230,7 @@ func TestRunTask_ExecuteOnce(t *testing.T) {
 		Name:         "deploy",
 		Description:  "Deploy task",
 		Dependencies: []string{"build", "test"},
-		Action: func() error {
+		Action: func(ctx context.Context) error {
 			inc("deploy")
 			return nil
 		},
@@ -0,0 +1,179 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Validate() checks the whole task graph up front and returns every
+// problem it finds as a *ValidationError: files of task definitions that
+// failed to load, tasks defined more than once,
+// invalid task names and parameters, missing working directories,
+// dependencies on unknown tasks and dependency cycles.
+// It returns nil if the graph is valid.
+func (tm *TaskManager) Validate() error {
+	tm.mu.Lock()
+	tasks := make(map[string]*Task, len(tm.tasks))
+	for name, task := range tm.tasks {
+		tasks[name] = task
+	}
+	duplicates := append([]*Task(nil), tm.duplicates...)
+	problems := append([]error(nil), tm.loadErrors...)
+	tm.mu.Unlock()
+
+	names := make([]string, 0, len(tasks))
+	for name := range tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, dup := range duplicates {
+		problems = append(problems, fmt.Errorf(
+			"task '%s' is defined more than once (in %s and %s)",
+			dup.Name,
+			describeSource(tasks[dup.Name]),
+			describeSource(dup),
+		))
+	}
+
+	for _, name := range names {
+		if err := validateTaskName(name); err != nil {
+			problems = append(problems, err)
+		}
+		if err := validateParams(tasks[name].Params); err != nil {
+			problems = append(problems, fmt.Errorf(
+				"task '%s': %w",
+				name,
+				err,
+			))
+		}
+		if dir := tasks[name].Dir; dir != "" {
+			if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+				problems = append(problems, fmt.Errorf(
+					"task '%s': directory '%s' does not exist",
+					name,
+					dir,
+				))
+			}
+		}
+	}
+
+	for _, name := range names {
+		for _, dep := range tasks[name].Dependencies {
+			if _, ok := tasks[dep]; !ok {
+				problems = append(problems, fmt.Errorf(
+					"task '%s' depends on unknown task '%s'%s",
+					name,
+					dep,
+					didYouMean(suggestNames(dep, names)),
+				))
+			}
+		}
+	}
+
+	for _, cycle := range findCycles(tasks, names) {
+		problems = append(problems, fmt.Errorf(
+			"circular dependency: %s",
+			strings.Join(cycle, " -> "),
+		))
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: problems}
+}
+
+// validateTaskName() rejects names that cannot be passed on the command
+// line as a task name
+func validateTaskName(name string) error {
+	if name == "" {
+		return fmt.Errorf("invalid task name '': must not be empty")
+	}
+	if strings.HasPrefix(name, "-") {
+		return fmt.Errorf(
+			"invalid task name '%s': must not start with '-'",
+			name,
+		)
+	}
+	for _, r := range name {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return fmt.Errorf(
+				"invalid task name '%s': must not contain whitespace",
+				name,
+			)
+		}
+	}
+	return nil
+}
+
+// findCycles() walks the graph depth-first in the order of names and
+// returns each distinct cycle once as the path of task names that leads
+// back to its first task, e.g. [a b c a].
+func findCycles(tasks map[string]*Task, names []string) [][]string {
+	const (
+		unvisited = iota
+		inProgress
+		done
+	)
+	state := make(map[string]int, len(tasks))
+	seen := make(map[string]bool)
+	var stack []string
+	var cycles [][]string
+
+	var visit func(name string)
+	visit = func(name string) {
+		state[name] = inProgress
+		stack = append(stack, name)
+		for _, dep := range tasks[name].Dependencies {
+			if _, ok := tasks[dep]; !ok {
+				continue
+			}
+			switch state[dep] {
+			case unvisited:
+				visit(dep)
+			case inProgress:
+				start := len(stack) - 1
+				for stack[start] != dep {
+					start--
+				}
+				cycle := append([]string{}, stack[start:]...)
+				if key := cycleKey(cycle); !seen[key] {
+					seen[key] = true
+					cycles = append(cycles, append(cycle, dep))
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[name] = done
+	}
+
+	for _, name := range names {
+		if state[name] == unvisited {
+			visit(name)
+		}
+	}
+	return cycles
+}
+
+// cycleKey() identifies a cycle regardless of the task it was entered at
+func cycleKey(cycle []string) string {
+	first := 0
+	for i, name := range cycle {
+		if name < cycle[first] {
+			first = i
+		}
+	}
+	rotated := append(append([]string{}, cycle[first:]...), cycle[:first]...)
+	return strings.Join(rotated, "\x00")
+}
+
+func describeSource(task *Task) string {
+	if task == nil || task.Source == "" {
+		return "Go code"
+	}
+	return task.Source
+}
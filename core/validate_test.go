@@ -0,0 +1,114 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate_Valid(t *testing.T) {
+	tm := NewTaskManager()
+	require.NoError(t, tm.Register(&Task{Name: "clean"}))
+	require.NoError(t, tm.Register(&Task{
+		Name:         "build",
+		Dependencies: []string{"clean"},
+	}))
+
+	require.NoError(t, tm.Validate())
+}
+
+func TestValidate_ReportsEveryProblem(t *testing.T) {
+	tm := NewTaskManager()
+	require.NoError(t, tm.RegisterFromConfig(&TasksConfig{
+		Tasks: map[string]TaskConfig{
+			"a":       {Depends: []string{"b"}},
+			"b":       {Depends: []string{"c"}},
+			"c":       {Depends: []string{"a"}},
+			"self":    {Depends: []string{"self"}},
+			"build":   {Depends: []string{"generate", "vendor"}},
+			"my task": {},
+		},
+		file: ".groolp/tasks.yaml",
+	}))
+	require.Error(t, tm.Register(&Task{
+		Name:   "build",
+		Source: ".groolp/scripts/build.lua",
+	}))
+
+	err := tm.Validate()
+	require.Error(t, err)
+	require.Equal(t, []string{
+		"task 'build' is defined more than once " +
+			"(in .groolp/tasks.yaml and .groolp/scripts/build.lua)",
+		"invalid task name 'my task': must not contain whitespace",
+		"task 'build' depends on unknown task 'generate'",
+		"task 'build' depends on unknown task 'vendor'",
+		"circular dependency: a -> b -> c -> a",
+		"circular dependency: self -> self",
+	}, strings.Split(err.Error(), "\n"))
+}
+
+func TestValidate_CycleReportedOnce(t *testing.T) {
+	tm := NewTaskManager()
+	require.NoError(t, tm.Register(&Task{
+		Name:         "x",
+		Dependencies: []string{"y"},
+	}))
+	require.NoError(t, tm.Register(&Task{
+		Name:         "y",
+		Dependencies: []string{"z"},
+	}))
+	require.NoError(t, tm.Register(&Task{
+		Name:         "z",
+		Dependencies: []string{"x"},
+	}))
+	require.NoError(t, tm.Register(&Task{
+		Name:         "w",
+		Dependencies: []string{"y", "-w"},
+	}))
+	require.NoError(t, tm.Register(&Task{Name: "-w"}))
+
+	err := tm.Validate()
+	require.Error(t, err)
+	require.Equal(t, []string{
+		"invalid task name '-w': must not start with '-'",
+		"circular dependency: y -> z -> x -> y",
+	}, strings.Split(err.Error(), "\n"))
+}
+
+func TestValidate_ProblemsWithNewlines(t *testing.T) {
+	tm := NewTaskManager()
+	require.NoError(t, tm.Register(&Task{Name: "two\nlines"}))
+	require.NoError(t, tm.Register(&Task{
+		Name:         "build",
+		Dependencies: []string{"missing"},
+	}))
+
+	err := tm.Validate()
+	var invalid *ValidationError
+	require.ErrorAs(t, err, &invalid)
+	require.Len(t, invalid.Problems, 2)
+	require.EqualError(
+		t,
+		invalid.Problems[0],
+		"invalid task name 'two\nlines': must not contain whitespace",
+	)
+}
+
+func TestValidate_LoadErrors(t *testing.T) {
+	tm := NewTaskManager()
+	require.NoError(t, tm.Register(&Task{Name: "build"}))
+	tm.RecordLoadError(errors.New("lua script error in bad.lua: syntax error"))
+
+	err := tm.Validate()
+	var invalid *ValidationError
+	require.ErrorAs(t, err, &invalid)
+	require.Len(t, invalid.Problems, 1)
+	require.EqualError(
+		t,
+		invalid.Problems[0],
+		"lua script error in bad.lua: syntax error",
+	)
+}
@@ -1,11 +1,16 @@
 package scripts
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 
 	"github.com/ystepanoff/groolp/core"
@@ -15,7 +20,10 @@ import (
 var GlobalDataStore *DataStore
 
 // LoadScripts() loads all *.lua scripts from scriptsDir in a sandboxed
-// Lua enviroment and registers tasks with the TaskManager.
+// Lua enviroment and registers tasks with the TaskManager. Scripts that
+// fail to load do not keep the others from loading; they are recorded on
+// the TaskManager for Validate() and returned together as a
+// *core.ConfigError.
 func LoadScripts(scriptsDir string, tm *core.TaskManager) error {
 	files, err := os.ReadDir(scriptsDir)
 	if err != nil {
@@ -26,16 +34,21 @@ func LoadScripts(scriptsDir string, tm *core.TaskManager) error {
 		)
 	}
 
+	var loadErrors []error
 	for _, fi := range files {
 		if fi.IsDir() || !strings.HasSuffix(fi.Name(), ".lua") {
 			continue
 		}
 		scriptPath := filepath.Join(scriptsDir, fi.Name())
 		if err := loadScript(scriptPath, fi.Name(), tm); err != nil {
-			fmt.Printf("Error loading script %s: %v\n", scriptPath, err)
+			tm.RecordLoadError(err)
+			loadErrors = append(loadErrors, err)
 		}
 	}
 
+	if len(loadErrors) > 0 {
+		return &core.ConfigError{Err: errors.Join(loadErrors...)}
+	}
 	return nil
 }
 
@@ -46,6 +59,9 @@ func loadScript(scriptPath, scriptName string, tm *core.TaskManager) error {
 	sandboxLuaState(L)
 	engine := NewScriptEngine(scriptName)
 
+	st := &luaState{L: L, funcs: make(map[string]*lua.LFunction)}
+	state := newScriptState(scriptPath, st)
+
 	// Provide a function so user scripts can register tasks
 	L.SetGlobal("register_task", L.NewFunction(func(L *lua.LState) int {
 		name := L.CheckString(1)
@@ -53,8 +69,7 @@ func loadScript(scriptPath, scriptName string, tm *core.TaskManager) error {
 		fn := L.CheckFunction(3)
 
 		var deps []string
-		if L.GetTop() >= 4 {
-			tbl := L.CheckTable(4)
+		if tbl := L.OptTable(4, nil); tbl != nil {
 			tbl.ForEach(func(key, value lua.LValue) {
 				if key.Type() == lua.LTNumber && value.Type() == lua.LTString {
 					deps = append(deps, value.String())
@@ -66,13 +81,22 @@ func loadScript(scriptPath, scriptName string, tm *core.TaskManager) error {
 			Name:         name,
 			Description:  desc,
 			Dependencies: deps,
-			Action: func() error {
-				L.Push(fn)
-				if err := L.PCall(0, 0, nil); err != nil {
-					return fmt.Errorf("lua runtime error: %v", err)
-				}
-				return nil
-			},
+			Source:       scriptPath,
+		}
+		isolated := false
+		if opts := L.OptTable(5, nil); opts != nil {
+			applyTaskOptions(L, opts, task)
+			isolated = optBool(L, opts, "isolated")
+		}
+		if task.Service || isolated {
+			task.Action = func(ctx context.Context) error {
+				return state.callIsolated(ctx, name)
+			}
+		} else {
+			task.Action = func(ctx context.Context) error {
+				return state.call(ctx, name)
+			}
+			task.Lock = state.lock
 		}
 
 		if err := tm.Register(task); err != nil {
@@ -80,6 +104,7 @@ func loadScript(scriptPath, scriptName string, tm *core.TaskManager) error {
 			L.Error(lua.LString(err.Error()), 1)
 			return 0
 		}
+		st.funcs[name] = fn
 		engine.tasks = append(engine.tasks, task)
 
 		return 0
@@ -89,7 +114,36 @@ func loadScript(scriptPath, scriptName string, tm *core.TaskManager) error {
 		return fmt.Errorf("lua script error in %s: %w", scriptPath, err)
 	}
 
-	fmt.Printf("Loaded script: %s\n", scriptPath)
+	fmt.Fprintf(os.Stderr, "Loaded script: %s\n", scriptPath)
+	return nil
+}
+
+// RunScript() executes a Lua script in a fresh sandboxed state and then
+// calls its global run() function, if it defines one, with the task's
+// parameters as a table. It backs the `script` key of tasks.yaml;
+// register_task calls are ignored here since the script's tasks are
+// registered by LoadScripts().
+func RunScript(ctx context.Context, scriptPath string) error {
+	L := lua.NewState()
+	defer L.Close()
+
+	sandboxLuaState(L)
+	L.SetGlobal("register_task", L.NewFunction(func(L *lua.LState) int {
+		return 0
+	}))
+	L.SetContext(ctx)
+
+	if err := L.DoFile(scriptPath); err != nil {
+		return fmt.Errorf("lua script error in %s: %w", scriptPath, err)
+	}
+
+	if fn, ok := L.GetGlobal("run").(*lua.LFunction); ok {
+		L.Push(fn)
+		L.Push(paramsTable(L, core.TaskParams(ctx)))
+		if err := L.PCall(1, 0, nil); err != nil {
+			return fmt.Errorf("lua runtime error: %v", err)
+		}
+	}
 	return nil
 }
 
@@ -124,10 +178,40 @@ func sandboxLuaState(L *lua.LState) {
 		L.SetGlobal(foo, lua.LNil)
 	}
 
+	// print() goes through the task's output so that it is captured in
+	// the run results
+	L.SetGlobal("print", L.NewFunction(func(L *lua.LState) int {
+		parts := make([]string, L.GetTop())
+		for i := range parts {
+			parts[i] = L.ToStringMeta(L.Get(i + 1)).String()
+		}
+		fmt.Fprintln(
+			core.TaskStdout(luaContext(L)),
+			strings.Join(parts, "\t"),
+		)
+		return 0
+	}))
+
 	L.SetGlobal("run_command", L.NewFunction(func(L *lua.LState) int {
 		cmdString := L.CheckString(1)
 
-		code, err := runCommand(cmdString)
+		var env []string
+		if tbl := L.OptTable(2, nil); tbl != nil {
+			tbl.ForEach(func(key, value lua.LValue) {
+				if key.Type() != lua.LTString {
+					L.ArgError(2, "env keys must be strings")
+				}
+				switch value.Type() {
+				case lua.LTString, lua.LTNumber, lua.LTBool:
+				default:
+					L.ArgError(2, "env values must be strings")
+				}
+				env = append(env, key.String()+"="+value.String())
+			})
+			sort.Strings(env)
+		}
+
+		code, err := runCommand(luaContext(L), cmdString, env)
 		if err != nil {
 			L.Push(lua.LNil)
 			L.Push(lua.LString(err.Error()))
@@ -180,31 +264,54 @@ func sandboxLuaState(L *lua.LState) {
 	}))
 }
 
-func runCommand(cmdString string) (int, error) {
-	var cmd *exec.Cmd
-	if runtime.GOOS == "windows" {
-		cmd = exec.Command("cmd.exe", "/c", cmdString)
-	} else {
-		cmd = exec.Command("sh", "-c", cmdString)
+// luaContext() returns the context the state is currently running under
+func luaContext(L *lua.LState) context.Context {
+	if ctx := L.Context(); ctx != nil {
+		return ctx
 	}
-	output, err := cmd.CombinedOutput()
-	os.Stdout.Write(output)
+	return context.Background()
+}
+
+// runCommand() runs a shell command for run_command() in the task's
+// working directory, with the task's environment and then env added to
+// the environment of groolp. The command writes straight to the task's
+// output, so e.g. a development server's output shows up as it runs.
+func runCommand(
+	ctx context.Context,
+	cmdString string,
+	env []string,
+) (int, error) {
+	cmd := core.ShellCommand(ctx, cmdString)
+	cmd.Dir = core.TaskDir(ctx)
+	if taskEnv := core.TaskEnv(ctx); len(taskEnv)+len(env) > 0 {
+		cmd.Env = append(os.Environ(), taskEnv...)
+		cmd.Env = append(cmd.Env, env...)
+	}
+	// The output is streamed as it is written, e.g. for a development
+	// server; stderr is kept as well to report commands that were not found
+	var stderr bytes.Buffer
+	cmd.Stdout = core.TaskStdout(ctx)
+	cmd.Stderr = io.MultiWriter(core.TaskStderr(ctx), &stderr)
+	err := cmd.Run()
 	if err != nil {
+		if ctx.Err() != nil {
+			return -1, ctx.Err()
+		}
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			exitCode := exitErr.ExitCode()
 			if runtime.GOOS == "windows" {
 				if strings.Contains(
-					string(output),
+					stderr.String(),
 					"is not recognized as an internal or external command",
 				) {
 					return exitCode, fmt.Errorf(
 						"command not found: %s",
-						string(output),
+						stderr.String(),
 					)
 				}
 			} else {
 				if exitCode == 127 {
-					return exitCode, fmt.Errorf("command not found: %s", string(output))
+					return exitCode, fmt.Errorf("command not found: %s", stderr.String())
 				}
 			}
 			return exitErr.ExitCode(), nil
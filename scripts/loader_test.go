@@ -2,11 +2,13 @@ package scripts
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"os"
 	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"github.com/ystepanoff/groolp/core"
@@ -98,7 +100,9 @@ func TestLoadScripts_InvalidLuaScript(t *testing.T) {
 	)
 	tm := core.NewTaskManager()
 	err := LoadScripts(tmpDir, tm)
-	require.NoError(t, err)
+	var configErr *core.ConfigError
+	require.ErrorAs(t, err, &configErr)
+	require.Contains(t, err.Error(), "invalid.lua")
 	for _, engine := range scriptEngines {
 		switch engine.Name {
 		case "invalid.lua":
@@ -109,6 +113,11 @@ func TestLoadScripts_InvalidLuaScript(t *testing.T) {
 	}
 	require.Nil(t, getTask(tm, "invalid-task"))
 	require.NotNil(t, getTask(tm, "valid-task"))
+
+	// The broken script is reported by Validate()
+	err = tm.Validate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid.lua")
 }
 
 func TestLoadScripts_SkipNonLuaFiles(t *testing.T) {
@@ -157,7 +166,7 @@ end)
 	require.NoError(t, err)
 	task := getTask(tm, "invoke-task")
 	require.NotNil(t, task)
-	require.NoError(t, task.Action())
+	require.NoError(t, task.Action(context.Background()))
 }
 
 func TestLoadScripts_DisabledLuaFunctions(t *testing.T) {
@@ -252,6 +261,7 @@ register_task("deploy","Deploy the project",function() print("Deploying...") end
 	require.Empty(t, cleanTask.Dependencies)
 	require.Equal(t, []string{"clean"}, buildTask.Dependencies)
 	require.Equal(t, []string{"build"}, deployTask.Dependencies)
+	require.Equal(t, scriptAPath, deployTask.Source)
 }
 
 func TestLoadScript_NoDependencies(t *testing.T) {
@@ -302,7 +312,7 @@ register_task(
 	r, w, err := os.Pipe()
 	require.NoError(t, err)
 	os.Stdout = w
-	err = task.Action()
+	err = task.Action(context.Background())
 	require.NoError(t, err)
 	w.Close()
 	os.Stdout = oldStdout
@@ -385,7 +395,7 @@ end)
 	require.NoError(t, err)
 	task := getTask(tm, "checkKey")
 	require.NotNil(t, task)
-	err = task.Action()
+	err = task.Action(context.Background())
 	require.NoError(t, err)
 	ds.Close()
 }
@@ -408,7 +418,7 @@ end)
 	require.NoError(t, err)
 	task := getTask(tm, "invalid-cmd-task")
 	require.NotNil(t, task)
-	err = task.Action()
+	err = task.Action(context.Background())
 	require.NoError(t, err)
 }
 
@@ -457,7 +467,7 @@ end)
 	require.NoError(t, err)
 	task := getTask(tm, "custom-lua-action")
 	require.NotNil(t, task)
-	require.NoError(t, task.Action())
+	require.NoError(t, task.Action(context.Background()))
 }
 
 func TestLoadScript_SandboxCheck(t *testing.T) {
@@ -487,7 +497,7 @@ end)
 	require.NoError(t, err)
 	task := getTask(tm, "sandbox-task")
 	require.NotNil(t, task)
-	err = task.Action()
+	err = task.Action(context.Background())
 	require.NoError(t, err)
 }
 
@@ -510,3 +520,386 @@ set_data("repeatKey", "second")
 	require.Equal(t, "second", val)
 	ds.Close()
 }
+
+func TestLoadScript_ConcurrentTasksFromSameScript(t *testing.T) {
+	tmpDir := t.TempDir()
+	scriptPath := filepath.Join(tmpDir, "parallel.lua")
+	luaContent := `
+register_task("lint", "Lint", function()
+	local s = 0
+	for i = 1, 100000 do s = s + i end
+end)
+register_task("test", "Test", function()
+	local s = 0
+	for i = 1, 100000 do s = s + i end
+end)
+register_task("ci", "CI", function() end, { "lint", "test" })
+`
+	require.NoError(t, os.WriteFile(scriptPath, []byte(luaContent), 0644))
+	tm := core.NewTaskManager()
+	require.NoError(t, loadScript(scriptPath, "parallel", tm))
+	for i := 0; i < 10; i++ {
+		_, err := tm.RunContext(
+			context.Background(),
+			[]string{"ci"},
+			core.RunOptions{Jobs: 4},
+		)
+		require.NoError(t, err)
+	}
+}
+
+func TestLoadScript_SameScriptSharesState(t *testing.T) {
+	tmpDir := t.TempDir()
+	scriptPath := filepath.Join(tmpDir, "shared.lua")
+	luaContent := `
+loads = (loads or 0) + 1
+count = 0
+register_task("lint", "Lint", function() count = count + 1 end)
+register_task("test", "Test", function() count = count + 1 end)
+register_task("ci", "CI", function()
+	if loads ~= 1 or count ~= 2 then
+		error("loads=" .. loads .. " count=" .. count)
+	end
+end, { "lint", "test" })
+`
+	require.NoError(t, os.WriteFile(scriptPath, []byte(luaContent), 0644))
+	tm := core.NewTaskManager()
+	require.NoError(t, loadScript(scriptPath, "shared", tm))
+
+	// Tasks of the same script take turns in one state, so the top-level
+	// code runs once and the tasks see each other's globals
+	_, err := tm.RunContext(
+		context.Background(),
+		[]string{"ci"},
+		core.RunOptions{Jobs: 4},
+	)
+	require.NoError(t, err)
+}
+
+func TestLoadScript_IsolatedTasksRunInParallel(t *testing.T) {
+	tmpDir := t.TempDir()
+	scriptPath := filepath.Join(tmpDir, "ci.lua")
+	luaContent := `
+register_task("lint", "Lint", function()
+	run_command("sleep 1")
+end, nil, { isolated = true })
+register_task("test", "Test", function()
+	run_command("sleep 1")
+end, nil, { isolated = true })
+register_task("ci", "CI", function() end, { "lint", "test" })
+`
+	require.NoError(t, os.WriteFile(scriptPath, []byte(luaContent), 0644))
+	tm := core.NewTaskManager()
+	require.NoError(t, loadScript(scriptPath, "ci", tm))
+
+	start := time.Now()
+	_, err := tm.RunContext(
+		context.Background(),
+		[]string{"ci"},
+		core.RunOptions{Jobs: 2},
+	)
+	require.NoError(t, err)
+	require.Less(t, time.Since(start), 1800*time.Millisecond)
+}
+
+func TestLoadScript_ServiceRunsInOwnState(t *testing.T) {
+	tmpDir := t.TempDir()
+	scriptPath := filepath.Join(tmpDir, "dev.lua")
+	luaContent := `
+register_task("dev", "Dev server", function()
+	run_command("echo server-up; sleep 10")
+end, nil, { service = true })
+register_task("test", "Test", function() end)
+`
+	require.NoError(t, os.WriteFile(scriptPath, []byte(luaContent), 0644))
+	tm := core.NewTaskManager()
+	require.NoError(t, loadScript(scriptPath, "dev", tm))
+
+	oldStdout := os.Stdout
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	os.Stdout = w
+	defer func() { os.Stdout = oldStdout }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = tm.RunContext(ctx, []string{"dev"}, core.RunOptions{})
+	}()
+	defer func() {
+		cancel()
+		<-done
+		w.Close()
+	}()
+
+	// The service's output shows up while it is still running
+	lines := make(chan string)
+	go func() {
+		buf := make([]byte, 64)
+		var out []byte
+		for {
+			n, err := r.Read(buf)
+			out = append(out, buf[:n]...)
+			if bytes.Contains(out, []byte("server-up")) {
+				lines <- string(out)
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	select {
+	case <-lines:
+	case <-time.After(5 * time.Second):
+		t.Fatal("service output was not streamed")
+	}
+
+	// Other tasks of the script still run while the service is up
+	testDone := make(chan error, 1)
+	go func() { testDone <- tm.Run("test") }()
+	select {
+	case err := <-testDone:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("task blocked by the running service")
+	}
+}
+
+func TestLoadScript_TaskOptions(t *testing.T) {
+	tmpDir := t.TempDir()
+	scriptPath := filepath.Join(tmpDir, "options.lua")
+	luaContent := `
+register_task("build", "Build", function() end, nil, {
+	inputs = { "**/*.go", "go.mod" },
+	outputs = "build/app",
+	watch = { "**/*.go" },
+})
+register_task("serve", "Serve", function() end, { "build" }, {
+	service = true,
+	grace_period = 2.5,
+})
+`
+	require.NoError(t, os.WriteFile(scriptPath, []byte(luaContent), 0644))
+	tm := core.NewTaskManager()
+	require.NoError(t, loadScript(scriptPath, "options", tm))
+	task := getTask(tm, "build")
+	require.NotNil(t, task)
+	require.Equal(t, []string{"**/*.go", "go.mod"}, task.Inputs)
+	require.Equal(t, []string{"build/app"}, task.Outputs)
+	require.Equal(t, []string{"**/*.go"}, task.Watch)
+	require.False(t, task.AllowFailure)
+	require.False(t, task.Service)
+
+	task = getTask(tm, "serve")
+	require.NotNil(t, task)
+	require.True(t, task.Service)
+	require.Equal(t, 2500*time.Millisecond, task.GracePeriod)
+}
+
+func TestLoadScript_AllowFailureOption(t *testing.T) {
+	tmpDir := t.TempDir()
+	scriptPath := filepath.Join(tmpDir, "allow.lua")
+	luaContent := `
+register_task("lint", "Optional lint", function()
+	error("linter not installed")
+end, nil, { allow_failure = true })
+register_task("build", "Build", function() end, { "lint" })
+`
+	require.NoError(t, os.WriteFile(scriptPath, []byte(luaContent), 0644))
+	tm := core.NewTaskManager()
+	require.NoError(t, loadScript(scriptPath, "allow", tm))
+	require.True(t, getTask(tm, "lint").AllowFailure)
+	require.NoError(t, tm.Run("build"))
+}
+
+func TestLoadScript_InvalidTaskOptions(t *testing.T) {
+	tmpDir := t.TempDir()
+	scriptPath := filepath.Join(tmpDir, "bad_options.lua")
+	luaContent := `register_task("build", "Build", function() end, {}, { inputs = 42 })`
+	require.NoError(t, os.WriteFile(scriptPath, []byte(luaContent), 0644))
+	tm := core.NewTaskManager()
+	err := loadScript(scriptPath, "bad_options", tm)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "option 'inputs'")
+}
+
+func TestRunScript_CallsRun(t *testing.T) {
+	tmpDir := t.TempDir()
+	scriptPath := filepath.Join(tmpDir, "custom_task.lua")
+	luaContent := `
+register_task("ignored", "Not registered here", function() end)
+function run()
+	set_data("customRan", true)
+end
+`
+	require.NoError(t, os.WriteFile(scriptPath, []byte(luaContent), 0644))
+	ds, err := NewDataStore(tmpDir)
+	require.NoError(t, err)
+	GlobalDataStore = ds
+	defer ds.Close()
+
+	require.NoError(t, RunScript(context.Background(), scriptPath))
+	val, ok := GlobalDataStore.GetData("customRan")
+	require.True(t, ok)
+	require.Equal(t, true, val)
+}
+
+func TestRunScript_TaskEnv(t *testing.T) {
+	tmpDir := t.TempDir()
+	out := filepath.Join(tmpDir, "env.txt")
+	scriptsDir := filepath.Join(tmpDir, ".groolp", "scripts")
+	require.NoError(t, os.MkdirAll(scriptsDir, 0755))
+	require.NoError(t, os.WriteFile(
+		filepath.Join(scriptsDir, "s.lua"),
+		[]byte(`
+function run()
+	run_command("printf '%s %s %s' \"$FOO\" \"$GLOBAL\" \"$EXTRA\" > `+out+`",
+		{ EXTRA = "baz" })
+end
+`),
+		0644,
+	))
+	configPath := filepath.Join(tmpDir, ".groolp", "tasks.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+env:
+  GLOBAL: qux
+tasks:
+  scripted:
+    script: s.lua
+    env:
+      FOO: bar
+`), 0644))
+
+	origRunner := core.ScriptRunner
+	core.ScriptRunner = RunScript
+	defer func() { core.ScriptRunner = origRunner }()
+
+	config, err := core.LoadConfig(configPath)
+	require.NoError(t, err)
+	tm := core.NewTaskManager()
+	require.NoError(t, tm.RegisterFromConfig(config))
+	require.NoError(t, tm.Run("scripted"))
+
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	require.Equal(t, "bar qux baz", string(data))
+}
+
+func TestLoadScript_Timeout(t *testing.T) {
+	tmpDir := t.TempDir()
+	scriptPath := filepath.Join(tmpDir, "loop.lua")
+	luaContent := `
+register_task("spin", "Never finishes", function()
+	while true do end
+end, nil, { timeout = 0.2 })
+register_task("after", "Runs after a timeout", function() end)
+`
+	require.NoError(t, os.WriteFile(scriptPath, []byte(luaContent), 0644))
+	tm := core.NewTaskManager()
+	require.NoError(t, loadScript(scriptPath, "loop", tm))
+
+	err := tm.Run("spin")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "task 'spin' failed: timed out after 200ms")
+
+	// The script can still run other tasks afterwards
+	require.NoError(t, tm.Run("after"))
+}
+
+func TestLoadScript_OutputCaptured(t *testing.T) {
+	tmpDir := t.TempDir()
+	scriptPath := filepath.Join(tmpDir, "output.lua")
+	luaContent := `
+register_task("talk", "Prints output", function()
+	print("from", "print")
+	run_command("echo from run_command")
+end)
+`
+	require.NoError(t, os.WriteFile(scriptPath, []byte(luaContent), 0644))
+	tm := core.NewTaskManager()
+	require.NoError(t, loadScript(scriptPath, "output", tm))
+
+	results, err := tm.RunContext(
+		context.Background(),
+		[]string{"talk"},
+		core.RunOptions{CaptureOutput: true},
+	)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, "from\tprint\nfrom run_command\n", results[0].Output)
+}
+
+func TestLoadScript_Params(t *testing.T) {
+	tmpDir := t.TempDir()
+	scriptPath := filepath.Join(tmpDir, "params.lua")
+	luaContent := `
+register_task("deploy", "Deploy", function(params)
+	set_data("deployed", params.env .. "/" .. params.region)
+end, nil, {
+	params = { "env", { name = "region", default = "eu", enum = { "eu", "us" } } },
+})
+`
+	require.NoError(t, os.WriteFile(scriptPath, []byte(luaContent), 0644))
+	ds, err := NewDataStore(tmpDir)
+	require.NoError(t, err)
+	GlobalDataStore = ds
+	defer ds.Close()
+
+	tm := core.NewTaskManager()
+	require.NoError(t, loadScript(scriptPath, "params", tm))
+	require.Equal(t, []core.Param{
+		{Name: "env"},
+		{Name: "region", Default: "eu", Enum: []string{"eu", "us"}},
+	}, getTask(tm, "deploy").Params)
+
+	_, err = tm.RunContext(
+		context.Background(),
+		[]string{"deploy"},
+		core.RunOptions{Params: map[string]string{"env": "prod"}},
+	)
+	require.NoError(t, err)
+	val, ok := GlobalDataStore.GetData("deployed")
+	require.True(t, ok)
+	require.Equal(t, "prod/eu", val)
+}
+
+func TestLoadScript_RunCommandEnv(t *testing.T) {
+	tmpDir := t.TempDir()
+	out := filepath.Join(tmpDir, "env.txt")
+	scriptPath := filepath.Join(tmpDir, "env.lua")
+	luaContent := `
+register_task("env", "Env", function()
+	local code, err = run_command('printf "%s-%s" "$STAGE" "$LEVEL" > ` + out + `', { STAGE = "ci", LEVEL = 3 })
+	if err ~= nil or code ~= 0 then error("run_command failed") end
+end)
+`
+	require.NoError(t, os.WriteFile(scriptPath, []byte(luaContent), 0644))
+	tm := core.NewTaskManager()
+	require.NoError(t, loadScript(scriptPath, "env", tm))
+	require.NoError(t, tm.Run("env"))
+
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	require.Equal(t, "ci-3", string(data))
+}
+
+func TestLoadScript_DirOption(t *testing.T) {
+	tmpDir := t.TempDir()
+	workDir := filepath.Join(tmpDir, "services", "api")
+	require.NoError(t, os.MkdirAll(workDir, 0755))
+	scriptPath := filepath.Join(tmpDir, "dir.lua")
+	luaContent := `
+register_task("api", "API", function()
+	local code, err = run_command("touch marker")
+	if err ~= nil or code ~= 0 then error("run_command failed") end
+end, nil, { dir = "` + workDir + `" })
+`
+	require.NoError(t, os.WriteFile(scriptPath, []byte(luaContent), 0644))
+	tm := core.NewTaskManager()
+	require.NoError(t, loadScript(scriptPath, "dir", tm))
+	require.Equal(t, workDir, getTask(tm, "api").Dir)
+	require.NoError(t, tm.Run("api"))
+	require.FileExists(t, filepath.Join(workDir, "marker"))
+}
@@ -0,0 +1,137 @@
+package scripts
+
+import (
+	"time"
+
+	"github.com/ystepanoff/groolp/core"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// applyTaskOptions() copies the optional options table passed as the
+// fifth argument of register_task onto the task, e.g.
+//
+//	register_task("build", "Build", fn, { "clean" }, {
+//	  inputs = { "**/*.go", "go.mod" },
+//	  outputs = { "build/groolp" },
+//	  watch = { "**/*.go" },
+//	  timeout = 300,
+//	  service = false,
+//	  isolated = false,
+//	  grace_period = 5,
+//	  allow_failure = false,
+//	  params = { "target", { name = "env", default = "dev" } },
+//	  dir = "services/api",
+//	})
+func applyTaskOptions(L *lua.LState, opts *lua.LTable, task *core.Task) {
+	task.Inputs = optStringList(L, opts, "inputs")
+	task.Outputs = optStringList(L, opts, "outputs")
+	task.Watch = optStringList(L, opts, "watch")
+	task.Timeout = optSeconds(L, opts, "timeout")
+	task.Service = optBool(L, opts, "service")
+	task.GracePeriod = optSeconds(L, opts, "grace_period")
+	task.AllowFailure = optBool(L, opts, "allow_failure")
+	task.Params = optParams(L, opts, "params")
+	task.Dir = optString(L, opts, "dir")
+}
+
+// optParams() reads a list of parameter declarations. Each entry is either
+// a parameter name or a table with name, description, default, required
+// and enum fields.
+func optParams(L *lua.LState, opts *lua.LTable, key string) []core.Param {
+	var params []core.Param
+	switch v := opts.RawGetString(key).(type) {
+	case *lua.LNilType:
+		return nil
+	case *lua.LTable:
+		v.ForEach(func(k, value lua.LValue) {
+			if k.Type() != lua.LTNumber {
+				L.RaiseError("option '%s' must be a list", key)
+			}
+			switch decl := value.(type) {
+			case lua.LString:
+				params = append(params, core.Param{Name: string(decl)})
+			case *lua.LTable:
+				params = append(params, core.Param{
+					Name:        optString(L, decl, "name"),
+					Description: optString(L, decl, "description"),
+					Default:     optString(L, decl, "default"),
+					Required:    optBool(L, decl, "required"),
+					Enum:        optStringList(L, decl, "enum"),
+				})
+			default:
+				L.RaiseError(
+					"option '%s' must list parameter names or tables",
+					key,
+				)
+			}
+		})
+		return params
+	default:
+		L.RaiseError("option '%s' must be a list", key)
+		return nil
+	}
+}
+
+// optString() reads a string field; numbers are converted to strings.
+func optString(L *lua.LState, opts *lua.LTable, key string) string {
+	switch v := opts.RawGetString(key).(type) {
+	case *lua.LNilType:
+		return ""
+	case lua.LString, lua.LNumber:
+		return v.String()
+	default:
+		L.RaiseError("option '%s' must be a string", key)
+		return ""
+	}
+}
+
+// optStringList() reads a field that may hold either a single string or
+// a list of strings.
+func optStringList(L *lua.LState, opts *lua.LTable, key string) []string {
+	switch v := opts.RawGetString(key).(type) {
+	case *lua.LNilType:
+		return nil
+	case lua.LString:
+		return []string{string(v)}
+	case *lua.LTable:
+		var list []string
+		v.ForEach(func(k, value lua.LValue) {
+			if k.Type() != lua.LTNumber || value.Type() != lua.LTString {
+				L.RaiseError("option '%s' must be a list of strings", key)
+			}
+			list = append(list, value.String())
+		})
+		return list
+	default:
+		L.RaiseError("option '%s' must be a string or a list of strings", key)
+		return nil
+	}
+}
+
+// optSeconds() reads a non-negative number of seconds as a duration.
+func optSeconds(L *lua.LState, opts *lua.LTable, key string) time.Duration {
+	switch v := opts.RawGetString(key).(type) {
+	case *lua.LNilType:
+		return 0
+	case lua.LNumber:
+		if v < 0 {
+			L.RaiseError("option '%s' must not be negative", key)
+		}
+		return time.Duration(float64(v) * float64(time.Second))
+	default:
+		L.RaiseError("option '%s' must be a number of seconds", key)
+		return 0
+	}
+}
+
+func optBool(L *lua.LState, opts *lua.LTable, key string) bool {
+	switch v := opts.RawGetString(key).(type) {
+	case *lua.LNilType:
+		return false
+	case lua.LBool:
+		return bool(v)
+	default:
+		L.RaiseError("option '%s' must be a boolean", key)
+		return false
+	}
+}
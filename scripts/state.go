@@ -0,0 +1,140 @@
+package scripts
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/ystepanoff/groolp/core"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// luaState is a Lua VM that has executed a script's top-level code,
+// together with the task functions the script registered in it.
+type luaState struct {
+	L     *lua.LState
+	funcs map[string]*lua.LFunction
+}
+
+// scriptState holds the Lua state of a single script. An LState must not
+// be used from several goroutines at once, so tasks of the same script
+// take turns: they share lock, which makes them run one at a time even
+// with --jobs, and share the script's globals and upvalues as well as the
+// effects of its top-level code, which runs only once. Tasks of different
+// scripts run in parallel.
+type scriptState struct {
+	scriptPath string
+	lock       *core.TaskLock
+
+	mu sync.Mutex
+	// st is nil after an interrupted call closed it
+	st *luaState
+}
+
+func newScriptState(scriptPath string, initial *luaState) *scriptState {
+	return &scriptState{
+		scriptPath: scriptPath,
+		lock:       core.NewTaskLock(),
+		st:         initial,
+	}
+}
+
+// load() re-executes the script in a new sandboxed state, which is needed
+// after a task of the script was interrupted and for every run of a
+// service or isolated task. Here register_task
+// only records the task functions instead of registering the tasks again.
+func (s *scriptState) load() (*luaState, error) {
+	L := lua.NewState()
+	sandboxLuaState(L)
+
+	st := &luaState{L: L, funcs: make(map[string]*lua.LFunction)}
+	L.SetGlobal("register_task", L.NewFunction(func(L *lua.LState) int {
+		st.funcs[L.CheckString(1)] = L.CheckFunction(3)
+		return 0
+	}))
+
+	if err := L.DoFile(s.scriptPath); err != nil {
+		L.Close()
+		return nil, fmt.Errorf("lua script error in %s: %w", s.scriptPath, err)
+	}
+	return st, nil
+}
+
+// paramsTable() converts task parameters into a Lua table
+func paramsTable(L *lua.LState, params map[string]string) *lua.LTable {
+	tbl := L.CreateTable(0, len(params))
+	for name, value := range params {
+		tbl.RawSetString(name, lua.LString(value))
+	}
+	return tbl
+}
+
+// call() runs the task function registered under name, passing the
+// task's parameters as a table. The scheduler holds the script's lock
+// while it runs, so no other task of the script is running. The state is
+// bound to ctx for the duration of the call, so cancelling ctx aborts the
+// Lua code as well as any command it is running.
+func (s *scriptState) call(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.st == nil {
+		st, err := s.load()
+		if err != nil {
+			return err
+		}
+		s.st = st
+	}
+
+	err := s.invoke(ctx, s.st, name)
+	if ctx.Err() != nil {
+		// An interrupted state may be left in an inconsistent condition
+		s.st.L.Close()
+		s.st = nil
+	}
+	return err
+}
+
+// callIsolated() runs the task registered under name in a state of its
+// own, which is discarded once the task returns, so that it does not wait
+// for the script's other tasks nor they for it. This is how services run,
+// as they must not keep the script's shared state to themselves until
+// they are stopped, and tasks registered with isolated = true, which may
+// then run in parallel with the script's other tasks.
+func (s *scriptState) callIsolated(ctx context.Context, name string) error {
+	st, err := s.load()
+	if err != nil {
+		return err
+	}
+	defer st.L.Close()
+
+	return s.invoke(ctx, st, name)
+}
+
+// invoke() calls the task function registered under name in st
+func (s *scriptState) invoke(
+	ctx context.Context,
+	st *luaState,
+	name string,
+) error {
+	fn, ok := st.funcs[name]
+	if !ok {
+		return fmt.Errorf(
+			"task '%s' is not registered by %s",
+			name,
+			s.scriptPath,
+		)
+	}
+
+	L := st.L
+	L.SetContext(ctx)
+	L.Push(fn)
+	L.Push(paramsTable(L, core.TaskParams(ctx)))
+	err := L.PCall(1, 0, nil)
+	L.RemoveContext()
+
+	if err != nil {
+		return fmt.Errorf("lua runtime error: %v", err)
+	}
+	return nil
+}
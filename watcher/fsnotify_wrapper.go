@@ -5,6 +5,7 @@ import "github.com/fsnotify/fsnotify"
 // WatcherInterface defines the methods and channels used by Watcher
 type WatcherInterface interface {
 	Add(name string) error
+	Remove(name string) error
 	Close() error
 	Events() <-chan fsnotify.Event
 	Errors() <-chan error
@@ -0,0 +1,131 @@
+package watcher
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// DefaultExclude lists the glob patterns of files that never trigger a
+// task, such as editor swap and backup files
+var DefaultExclude = []string{
+	"**/*.swp",
+	"**/*.swx",
+	"**/*~",
+	"**/.#*",
+	"**/#*#",
+	"**/4913",
+	"**/.DS_Store",
+}
+
+// IgnoreFiles names the .gitignore-style files in the project root whose
+// patterns the watch command excludes
+var IgnoreFiles = []string{".gitignore", ".groolpignore"}
+
+// ignoreRule excludes the paths matching a glob pattern, or includes them
+// again if negated
+type ignoreRule struct {
+	pattern string
+	negate  bool
+	// dirOnly rules match directories and the paths below them only
+	dirOnly bool
+}
+
+// matches() reports whether the rule applies to p, a slash-separated path
+// relative to the project root. A rule matching a directory applies to
+// everything below it.
+func (r ignoreRule) matches(p string, isDir bool) bool {
+	if ok, _ := doublestar.Match(r.pattern, p); ok && (isDir || !r.dirOnly) {
+		return true
+	}
+	for dir := path.Dir(p); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if ok, _ := doublestar.Match(r.pattern, dir); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isExcluded() applies the rules in order, so that a later rule overrides
+// an earlier one, the way .gitignore negations work
+func isExcluded(rules []ignoreRule, p string, isDir bool) bool {
+	excluded := false
+	for _, rule := range rules {
+		if rule.matches(p, isDir) {
+			excluded = !rule.negate
+		}
+	}
+	return excluded
+}
+
+// globRules() turns doublestar patterns into exclude rules
+func globRules(patterns []string) []ignoreRule {
+	rules := make([]ignoreRule, 0, len(patterns))
+	for _, pattern := range patterns {
+		rules = append(rules, ignoreRule{pattern: pattern})
+	}
+	return rules
+}
+
+// readIgnoreFile() reads the rules of a .gitignore-style file. A missing
+// file has no rules.
+func readIgnoreFile(filename string) ([]ignoreRule, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open ignore file: %w", err)
+	}
+	defer f.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreLine(scanner.Text()); ok {
+			rules = append(rules, rule)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filename, err)
+	}
+	return rules, nil
+}
+
+// parseIgnoreLine() converts a .gitignore line into a rule. As in git, a
+// pattern without a slash matches at any depth, while one with a slash is
+// relative to the project root; a trailing slash matches directories only
+// and a leading '!' includes matching paths again.
+func parseIgnoreLine(line string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	var rule ignoreRule
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		// \# and \! escape a leading # or !
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	if strings.Contains(line, "/") {
+		rule.pattern = strings.TrimPrefix(line, "/")
+	} else {
+		rule.pattern = "**/" + line
+	}
+	return rule, true
+}
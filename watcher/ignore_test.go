@@ -0,0 +1,73 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIgnoreLine(t *testing.T) {
+	for _, tc := range []struct {
+		line     string
+		expected ignoreRule
+		ok       bool
+	}{
+		{"", ignoreRule{}, false},
+		{"# comment", ignoreRule{}, false},
+		{"*.log", ignoreRule{pattern: "**/*.log"}, true},
+		{"build/", ignoreRule{pattern: "**/build", dirOnly: true}, true},
+		{"/dist", ignoreRule{pattern: "dist"}, true},
+		{"docs/*.html  ", ignoreRule{pattern: "docs/*.html"}, true},
+		{"!keep.log", ignoreRule{pattern: "**/keep.log", negate: true}, true},
+		{`\#notes`, ignoreRule{pattern: "**/#notes"}, true},
+	} {
+		rule, ok := parseIgnoreLine(tc.line)
+		require.Equal(t, tc.ok, ok, tc.line)
+		require.Equal(t, tc.expected, rule, tc.line)
+	}
+}
+
+func TestIsExcluded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".gitignore")
+	require.NoError(t, os.WriteFile(path, []byte(
+		"# build outputs\n"+
+			"build/\n"+
+			"/dist\n"+
+			"*.log\n"+
+			"!keep.log\n",
+	), 0644))
+	rules, err := readIgnoreFile(path)
+	require.NoError(t, err)
+	rules = append(rules, globRules([]string{"gen/**/*.pb.go"})...)
+
+	for _, tc := range []struct {
+		path     string
+		isDir    bool
+		expected bool
+	}{
+		{"build", true, true},
+		{"build", false, false},
+		{"build/out/app", false, true},
+		{"cmd/build/app", false, true},
+		{"dist/app.js", false, true},
+		{"web/dist/app.js", false, false},
+		{"server.log", false, true},
+		{"logs/keep.log", false, false},
+		{"gen/api/v1/api.pb.go", false, true},
+		{"gen/api/v1/api.go", false, false},
+		{"main.go", false, false},
+	} {
+		require.Equal(
+			t,
+			tc.expected,
+			isExcluded(rules, tc.path, tc.isDir),
+			tc.path,
+		)
+	}
+
+	rules, err = readIgnoreFile(filepath.Join(t.TempDir(), "missing"))
+	require.NoError(t, err)
+	require.Empty(t, rules)
+}
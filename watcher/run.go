@@ -0,0 +1,145 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/ystepanoff/groolp/core"
+)
+
+// OnChange is the policy for changes that trigger tasks while a run
+// started by an earlier change is still in progress
+type OnChange string
+
+const (
+	// OnChangeQueue collects the tasks triggered during a run and runs
+	// them together in one follow-up run once it has finished
+	OnChangeQueue OnChange = "queue"
+	// OnChangeRestart cancels the run and starts it again, along with the
+	// newly triggered tasks
+	OnChangeRestart OnChange = "restart"
+	// OnChangeIgnore drops changes made during a run
+	OnChangeIgnore OnChange = "ignore"
+)
+
+// ParseOnChange() converts the name of a policy into an OnChange
+func ParseOnChange(name string) (OnChange, error) {
+	switch policy := OnChange(name); policy {
+	case OnChangeQueue, OnChangeRestart, OnChangeIgnore:
+		return policy, nil
+	default:
+		return "", fmt.Errorf(
+			"unknown on-change policy '%s'; expected queue, restart or ignore",
+			name,
+		)
+	}
+}
+
+// taskRun is a run of triggered tasks in progress
+type taskRun struct {
+	tasks  []string
+	cancel context.CancelFunc
+	// done is closed once the run has returned
+	done chan struct{}
+}
+
+// SetOnChange() sets how changes are handled while the tasks triggered by
+// an earlier change are running. The default is OnChangeQueue.
+func (w *Watcher) SetOnChange(policy OnChange) {
+	w.onChange = policy
+}
+
+// schedule() runs the triggered tasks or, while a run is in progress,
+// handles them according to the on-change policy
+func (w *Watcher) schedule(tasks []string) {
+	if w.run == nil {
+		w.startRun(tasks)
+		return
+	}
+
+	switch w.onChange {
+	case OnChangeIgnore:
+		log.Printf(
+			"Ignoring change for %s: a run is in progress\n",
+			describeTasks(tasks),
+		)
+	case OnChangeRestart:
+		// The cancelled tasks run again together with the new ones
+		for _, task := range w.run.tasks {
+			w.queued[task] = true
+		}
+		for _, task := range tasks {
+			w.queued[task] = true
+		}
+		log.Printf("Restarting %s\n", describeTasks(w.run.tasks))
+		w.run.cancel()
+	default:
+		for _, task := range tasks {
+			w.queued[task] = true
+		}
+		log.Printf(
+			"Queueing %s until the current run has finished\n",
+			describeTasks(tasks),
+		)
+	}
+}
+
+// startRun() runs tasks in the background, so that changes keep being
+// picked up while they run
+func (w *Watcher) startRun(tasks []string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &taskRun{tasks: tasks, cancel: cancel, done: make(chan struct{})}
+	w.run = run
+
+	go func() {
+		defer close(run.done)
+		_, err := w.taskManager.RunContext(ctx, tasks, core.RunOptions{})
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error running %s: %v\n", describeTasks(tasks), err)
+		}
+	}()
+}
+
+// runDone() returns a channel that is closed when the current run has
+// returned; it is nil, and so never ready, while no run is in progress
+func (w *Watcher) runDone() <-chan struct{} {
+	if w.run == nil {
+		return nil
+	}
+	return w.run.done
+}
+
+// finishRun() clears the run that has returned and starts the queued
+// tasks, if any, in one follow-up run
+func (w *Watcher) finishRun() {
+	w.run.cancel()
+	w.run = nil
+	if tasks, _ := w.pendingTasks(w.queued); len(tasks) > 0 {
+		w.startRun(tasks)
+	}
+}
+
+// stopRun() cancels the current run and waits for it to return
+func (w *Watcher) stopRun() {
+	if w.run == nil {
+		return
+	}
+	w.run.cancel()
+	<-w.run.done
+	w.run = nil
+}
+
+// ignoring() reports whether a change triggering task is dropped because
+// of a run in progress. Services are restarted regardless.
+func (w *Watcher) ignoring(task string) bool {
+	if w.run == nil || w.onChange != OnChangeIgnore {
+		return false
+	}
+	for _, rule := range w.rules {
+		if rule.Task == task && rule.Service {
+			return false
+		}
+	}
+	return true
+}
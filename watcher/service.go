@@ -0,0 +1,69 @@
+package watcher
+
+import (
+	"context"
+	"log"
+
+	"github.com/ystepanoff/groolp/core"
+)
+
+// service is a service task running in the background
+type service struct {
+	cancel context.CancelFunc
+	// done is closed once the task and its dependencies have returned
+	done chan struct{}
+}
+
+// startService() runs the service task name and its dependencies in the
+// background. A service that exits on its own, e.g. because it failed to
+// start, is started again on the next change.
+func (w *Watcher) startService(name string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &service{cancel: cancel, done: make(chan struct{})}
+	w.services[name] = s
+
+	log.Printf("Starting service %s\n", name)
+	go func() {
+		defer close(s.done)
+		_, err := w.taskManager.RunContext(
+			ctx,
+			[]string{name},
+			core.RunOptions{},
+		)
+		switch {
+		case ctx.Err() != nil:
+			// Stopped by the watcher
+		case err != nil:
+			log.Printf("Service %s failed: %v\n", name, err)
+		default:
+			log.Printf("Service %s exited\n", name)
+		}
+	}()
+}
+
+// stopService() stops the service task name, if it is running, and waits
+// for it to exit. Its commands get the task's grace period to shut down.
+func (w *Watcher) stopService(name string) {
+	s, ok := w.services[name]
+	if !ok {
+		return
+	}
+	delete(w.services, name)
+
+	log.Printf("Stopping service %s\n", name)
+	s.cancel()
+	<-s.done
+}
+
+// restartService() stops the service task name and starts it again,
+// running its dependencies first, e.g. to rebuild the server
+func (w *Watcher) restartService(name string) {
+	w.stopService(name)
+	w.startService(name)
+}
+
+func (w *Watcher) stopServices() {
+	for name := range w.services {
+		w.stopService(name)
+	}
+}
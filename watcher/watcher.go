@@ -1,22 +1,73 @@
 package watcher
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
 	"log"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/bmatcuk/doublestar/v4"
 	"github.com/fsnotify/fsnotify"
 	"github.com/ystepanoff/groolp/core"
 )
 
+// DefaultIgnoreDirs lists the directories that are not watched, wherever
+// they appear below a watched path
+var DefaultIgnoreDirs = []string{".git", ".hg", ".svn", "node_modules", ".groolp"}
+
+// Rule names the task to run when files matching one of its patterns
+// change. A rule without patterns matches every change.
+type Rule struct {
+	Task     string
+	Patterns []string
+	// Service tasks are started in the background when the watcher starts
+	// and restarted on changes, see core.Task.Service
+	Service bool
+}
+
 // Watcher manages file system events and triggers tasks
 type Watcher struct {
 	watcher          WatcherInterface
 	taskManager      core.TaskManagerInterface
 	watchPaths       []string
-	taskName         string
+	rules            []Rule
 	debounceDuration time.Duration
+	include          []string
+	exclude          []ignoreRule
+	ignoreDirs       []string
+	// watched holds the directories added to the underlying watcher
+	watched map[string]bool
+	// dir is the directory patterns are relative to, the working
+	// directory when the watcher was created
+	dir string
+	// services holds the running service tasks by name
+	services map[string]*service
+	onChange OnChange
+	// run is the run of triggered tasks in progress, if any, and queued
+	// holds the tasks to run once it has finished
+	run    *taskRun
+	queued map[string]bool
 }
 
+// Options holds the settings that decide which directories are watched.
+// They are applied before the initial walk, so that excluded directories
+// are never added to the underlying watcher.
+type Options struct {
+	// Exclude lists glob patterns of files that never trigger a task, in
+	// addition to DefaultExclude
+	Exclude []string
+	// IgnoreFiles lists .gitignore-style files whose patterns, relative to
+	// the directory the watcher runs in, are excluded as well. Missing
+	// files are skipped.
+	IgnoreFiles []string
+}
+
+// NewWatcher() creates a watcher that runs taskName on any change below
+// the given paths
 func NewWatcher(
 	tm core.TaskManagerInterface,
 	paths []string,
@@ -24,6 +75,49 @@ func NewWatcher(
 	debounceDuration time.Duration,
 	args ...WatcherInterface,
 ) (*Watcher, error) {
+	return NewMultiWatcher(
+		tm,
+		paths,
+		[]Rule{{Task: taskName}},
+		debounceDuration,
+		Options{},
+		args...,
+	)
+}
+
+// NewMultiWatcher() creates a watcher that runs the task of every rule
+// matching a change. Tasks triggered within the debounce duration run
+// together, each at most once. Without paths, the directories covered by
+// the rules' patterns are watched; those that do not exist are skipped.
+func NewMultiWatcher(
+	tm core.TaskManagerInterface,
+	paths []string,
+	rules []Rule,
+	debounceDuration time.Duration,
+	opts Options,
+	args ...WatcherInterface,
+) (*Watcher, error) {
+	exclude := globRules(DefaultExclude)
+	exclude = append(exclude, globRules(opts.Exclude)...)
+	for _, filename := range opts.IgnoreFiles {
+		fileRules, err := readIgnoreFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		exclude = append(exclude, fileRules...)
+	}
+
+	if len(paths) == 0 {
+		var patterns []string
+		for _, rule := range rules {
+			patterns = append(patterns, rule.Patterns...)
+		}
+		var err error
+		if paths, err = existingRoots(PatternRoots(patterns)); err != nil {
+			return nil, err
+		}
+	}
+
 	var w WatcherInterface
 	if len(args) > 0 {
 		w = args[0]
@@ -35,27 +129,273 @@ func NewWatcher(
 		w = &FSNotifyWrapper{Watcher: fw}
 	}
 
-	for _, path := range paths {
-		if err := w.Add(path); err != nil {
-			return nil, err
-		}
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
 	}
 
-	return &Watcher{
+	watcher := &Watcher{
 		watcher:          w,
 		taskManager:      tm,
 		watchPaths:       paths,
-		taskName:         taskName,
+		rules:            rules,
 		debounceDuration: debounceDuration,
-	}, nil
+		exclude:          exclude,
+		ignoreDirs:       DefaultIgnoreDirs,
+		watched:          make(map[string]bool),
+		dir:              dir,
+		services:         make(map[string]*service),
+		onChange:         OnChangeQueue,
+		queued:           make(map[string]bool),
+	}
+	for _, path := range paths {
+		if err := watcher.addRecursive(path); err != nil {
+			return nil, err
+		}
+	}
+	return watcher, nil
+}
+
+// addRecursive() watches root and every directory below it, except for
+// ignored ones. fsnotify only reports changes to the direct entries of a
+// watched directory, so each directory is added separately.
+func (w *Watcher) addRecursive(root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			// A directory that vanished or cannot be read does not stop
+			// the rest of the tree from being watched
+			log.Printf("Warning: not watching %s: %v\n", path, err)
+			return nil
+		}
+		if !d.IsDir() {
+			if path == root {
+				return w.watcher.Add(path)
+			}
+			return nil
+		}
+		if path != root &&
+			(w.isIgnoredDir(d.Name()) || w.isExcluded(path, true)) {
+			return filepath.SkipDir
+		}
+		if err := w.watcher.Add(path); err != nil {
+			return err
+		}
+		w.watched[filepath.Clean(path)] = true
+		return nil
+	})
+}
+
+// removeRecursive() stops watching dir and the directories below it
+func (w *Watcher) removeRecursive(dir string) {
+	dir = filepath.Clean(dir)
+	prefix := dir + string(filepath.Separator)
+	for path := range w.watched {
+		if path == dir || strings.HasPrefix(path, prefix) {
+			// fsnotify drops the watches of deleted directories itself,
+			// so failing to remove one is expected
+			_ = w.watcher.Remove(path)
+			delete(w.watched, path)
+		}
+	}
+}
+
+// handleDirEvent() keeps the watched directories in sync with the tree:
+// directories created after startup are added unless they are excluded,
+// removed or renamed ones are dropped
+func (w *Watcher) handleDirEvent(event fsnotify.Event) {
+	name := filepath.Clean(event.Name)
+	if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 && w.watched[name] {
+		w.removeRecursive(name)
+	}
+	if event.Op&fsnotify.Create == 0 {
+		return
+	}
+	if fi, err := os.Stat(name); err == nil && fi.IsDir() {
+		// Excluded directories are not watched at all, even when they
+		// are created, e.g. rebuilt, after startup
+		if w.isIgnoredDir(filepath.Base(name)) || w.isExcluded(name, true) {
+			return
+		}
+		if err := w.addRecursive(name); err != nil &&
+			!errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Warning: not watching %s: %v\n", name, err)
+		}
+	}
+}
+
+func (w *Watcher) isIgnoredDir(name string) bool {
+	for _, ignored := range w.ignoreDirs {
+		if name == ignored {
+			return true
+		}
+	}
+	return false
 }
 
+// isIgnored() reports whether path lies in an ignored directory below the
+// watched path it belongs to. Paths given explicitly are never ignored,
+// even if they are inside e.g. node_modules.
+func (w *Watcher) isIgnored(path string) bool {
+	for _, root := range w.watchPaths {
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == ".." ||
+			strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		for _, part := range strings.Split(filepath.ToSlash(rel), "/") {
+			if w.isIgnoredDir(part) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// SetInclude() restricts the events that trigger the task to files
+// matching at least one of the given glob patterns.
+func (w *Watcher) SetInclude(patterns []string) {
+	w.include = patterns
+}
+
+// relPath() returns name as a slash-separated path relative to the
+// directory patterns are resolved against. Paths outside of it are kept
+// absolute.
+func (w *Watcher) relPath(name string) string {
+	if filepath.IsAbs(name) {
+		rel, err := filepath.Rel(w.dir, name)
+		if err == nil && rel != ".." &&
+			!strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			name = rel
+		}
+	}
+	return filepath.ToSlash(filepath.Clean(name))
+}
+
+func (w *Watcher) isExcluded(name string, isDir bool) bool {
+	return isExcluded(w.exclude, w.relPath(name), isDir)
+}
+
+// existingRoots() drops the directories that do not exist, so that one
+// task's pattern for a missing directory does not stop the others from
+// being watched
+func existingRoots(roots []string) ([]string, error) {
+	existing := make([]string, 0, len(roots))
+	for _, root := range roots {
+		if _, err := os.Stat(root); err != nil {
+			log.Printf("Warning: not watching %s: %v\n", root, err)
+			continue
+		}
+		existing = append(existing, root)
+	}
+	if len(existing) == 0 && len(roots) > 0 {
+		return nil, fmt.Errorf(
+			"none of the watched directories exist: %s",
+			strings.Join(roots, ", "),
+		)
+	}
+	return existing, nil
+}
+
+// PatternRoots() returns the directories that have to be watched to see
+// changes to files matching the given glob patterns.
+func PatternRoots(patterns []string) []string {
+	seen := make(map[string]bool)
+	roots := []string{}
+	for _, pattern := range patterns {
+		base, _ := doublestar.SplitPattern(filepath.ToSlash(pattern))
+		root := filepath.FromSlash(base)
+		if !seen[root] {
+			seen[root] = true
+			roots = append(roots, root)
+		}
+	}
+	return roots
+}
+
+// matches() reports whether a change to name should trigger the task: it
+// must not be excluded and, if include patterns are set, match one of them
+func (w *Watcher) matches(name string) bool {
+	isDir := w.watched[filepath.Clean(name)]
+	if fi, err := os.Stat(name); err == nil && fi.IsDir() {
+		isDir = true
+	}
+	if w.isExcluded(name, isDir) {
+		return false
+	}
+	return len(w.include) == 0 || matchAny(w.include, w.relPath(name))
+}
+
+// pendingTasks() drains the triggered tasks, in the order of the rules,
+// and splits them into tasks to run and services to restart
+func (w *Watcher) pendingTasks(
+	pending map[string]bool,
+) (tasks []string, services []string) {
+	for _, rule := range w.rules {
+		if !pending[rule.Task] {
+			continue
+		}
+		if rule.Service {
+			services = append(services, rule.Task)
+		} else {
+			tasks = append(tasks, rule.Task)
+		}
+		delete(pending, rule.Task)
+	}
+	return tasks, services
+}
+
+func describeTasks(tasks []string) string {
+	if len(tasks) == 1 {
+		return fmt.Sprintf("task '%s'", tasks[0])
+	}
+	return "tasks " + strings.Join(tasks, ", ")
+}
+
+// triggered() returns the tasks whose rules match a change to name
+func (w *Watcher) triggered(name string) []string {
+	name = w.relPath(name)
+	var tasks []string
+	for _, rule := range w.rules {
+		if len(rule.Patterns) == 0 || matchAny(rule.Patterns, name) {
+			tasks = append(tasks, rule.Task)
+		}
+	}
+	return tasks
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := doublestar.Match(filepath.ToSlash(pattern), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Start() watches for changes until the underlying watcher is closed.
+// Triggered tasks run in the background while changes keep being picked
+// up, see SetOnChange(). Service tasks are started right away. A run in
+// progress and the services are stopped when it returns.
 func (w *Watcher) Start() {
 	defer w.watcher.Close()
+	defer w.stopServices()
+	defer w.stopRun()
 
 	log.Println("Starting file watcher...")
+	for _, rule := range w.rules {
+		if rule.Service {
+			w.startService(rule.Task)
+		}
+	}
+
 	var debounceTimer *time.Timer
 	var debounceC chan bool
+	// pending holds the tasks triggered since the last run
+	pending := make(map[string]bool)
 
 	for {
 		select {
@@ -63,6 +403,17 @@ func (w *Watcher) Start() {
 			if !ok {
 				return
 			}
+			if w.isIgnored(event.Name) {
+				continue
+			}
+			w.handleDirEvent(event)
+			if !w.matches(event.Name) {
+				continue
+			}
+			tasks := w.triggered(event.Name)
+			if len(tasks) == 0 {
+				continue
+			}
 
 			for _, op := range []fsnotify.Op{
 				fsnotify.Create,
@@ -73,6 +424,17 @@ func (w *Watcher) Start() {
 			} {
 				if event.Op&op == op {
 					log.Printf("Detected change in: %s\n", event.Name)
+					for _, task := range tasks {
+						if w.ignoring(task) {
+							log.Printf(
+								"Ignoring change for task '%s': "+
+									"a run is in progress\n",
+								task,
+							)
+							continue
+						}
+						pending[task] = true
+					}
 					if debounceTimer != nil {
 						debounceTimer.Stop()
 					}
@@ -86,13 +448,15 @@ func (w *Watcher) Start() {
 				}
 			}
 		case <-debounceC:
-			if err := w.taskManager.Run(w.taskName); err != nil {
-				log.Printf(
-					"Error running task '%s': %v\n",
-					w.taskName,
-					err,
-				)
+			tasks, services := w.pendingTasks(pending)
+			if len(tasks) > 0 {
+				w.schedule(tasks)
 			}
+			for _, name := range services {
+				w.restartService(name)
+			}
+		case <-w.runDone():
+			w.finishRun()
 		case err, ok := <-w.watcher.Errors():
 			if !ok {
 				return
@@ -101,3 +465,9 @@ func (w *Watcher) Start() {
 		}
 	}
 }
+
+// Close() stops watching, which makes Start() stop the running services
+// and return
+func (w *Watcher) Close() error {
+	return w.watcher.Close()
+}
@@ -1,13 +1,17 @@
 package watcher
 
 import (
+	"context"
 	"errors"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"github.com/ystepanoff/groolp/core"
 )
 
@@ -30,6 +34,11 @@ func (m *MockWatcher) Add(name string) error {
 	return args.Error(0)
 }
 
+func (m *MockWatcher) Remove(name string) error {
+	args := m.Called(name)
+	return args.Error(0)
+}
+
 func (m *MockWatcher) Close() error {
 	args := m.Called()
 	return args.Error(0)
@@ -53,19 +62,45 @@ func (m *MockTaskManager) Register(task *core.Task) error {
 	return args.Error(0)
 }
 
-func (m *MockTaskManager) Run(taskName string) error {
-	args := m.Called(taskName)
+func (m *MockTaskManager) Run(taskNames ...string) error {
+	callArgs := make([]interface{}, len(taskNames))
+	for i, name := range taskNames {
+		callArgs[i] = name
+	}
+	args := m.Called(callArgs...)
 	return args.Error(0)
 }
 
+func (m *MockTaskManager) RunContext(
+	ctx context.Context,
+	taskNames []string,
+	opts core.RunOptions,
+) ([]*core.RunResult, error) {
+	args := m.Called(ctx, taskNames, opts)
+	return nil, args.Error(0)
+}
+
 func (m *MockTaskManager) ListTasks() []*core.Task {
 	args := m.Called()
 	return args.Get(0).([]*core.Task)
 }
 
+// onRun() expects the watcher to run the given tasks
+func onRun(m *MockTaskManager, tasks ...string) *mock.Call {
+	return m.On("RunContext", mock.Anything, tasks, core.RunOptions{})
+}
+
+func assertRan(t *testing.T, m *MockTaskManager, tasks ...string) {
+	m.AssertCalled(t, "RunContext", mock.Anything, tasks, core.RunOptions{})
+}
+
+func assertNotRan(t *testing.T, m *MockTaskManager, tasks ...string) {
+	m.AssertNotCalled(t, "RunContext", mock.Anything, tasks, core.RunOptions{})
+}
+
 func TestWatcher_Start(t *testing.T) {
 	mockTM := new(MockTaskManager)
-	mockTM.On("Run", "deploy").Return(nil)
+	onRun(mockTM, "deploy").Return(nil)
 
 	mockWatcher := NewMockWatcher()
 	mockWatcher.events = make(chan fsnotify.Event)
@@ -97,10 +132,10 @@ func TestWatcher_Start(t *testing.T) {
 	mockWatcher.events <- event
 	time.Sleep(2 * debounceDuration)
 
-	mockTM.AssertNumberOfCalls(t, "Run", 1)
+	mockTM.AssertNumberOfCalls(t, "RunContext", 1)
 
 	mockTM.ExpectedCalls = nil
-	mockTM.On("Run", "deploy").Return(nil)
+	onRun(mockTM, "deploy").Return(nil)
 
 	mockWatcher.events <- event
 	mockWatcher.events <- event
@@ -108,16 +143,16 @@ func TestWatcher_Start(t *testing.T) {
 
 	time.Sleep(2 * debounceDuration)
 
-	mockTM.AssertNumberOfCalls(t, "Run", 2)
+	mockTM.AssertNumberOfCalls(t, "RunContext", 2)
 
 	mockTM.ExpectedCalls = nil
-	mockTM.On("Run", "deploy").Return(nil)
+	onRun(mockTM, "deploy").Return(nil)
 
 	mockWatcher.events <- event
 
 	time.Sleep(2 * debounceDuration)
 
-	mockTM.AssertNumberOfCalls(t, "Run", 3)
+	mockTM.AssertNumberOfCalls(t, "RunContext", 3)
 
 	mockWatcher.errors <- errors.New("watcher error (expected)")
 
@@ -160,7 +195,13 @@ func TestWatcher_NoEvents(t *testing.T) {
 
 	time.Sleep(100 * time.Millisecond)
 
-	mockTM.AssertNotCalled(t, "Run", mock.Anything)
+	mockTM.AssertNotCalled(
+		t,
+		"RunContext",
+		mock.Anything,
+		mock.Anything,
+		mock.Anything,
+	)
 
 	mockTM.AssertExpectations(t)
 	mockWatcher.AssertExpectations(t)
@@ -170,7 +211,7 @@ func TestWatcher_NoEvents(t *testing.T) {
 
 func TestWatcher_MultipleDebounceCycles(t *testing.T) {
 	mockTM := new(MockTaskManager)
-	mockTM.On("Run", "deploy").Return(nil)
+	onRun(mockTM, "deploy").Return(nil)
 
 	mockWatcher := NewMockWatcher()
 	mockWatcher.On("Add", ".").Return(nil)
@@ -203,15 +244,15 @@ func TestWatcher_MultipleDebounceCycles(t *testing.T) {
 
 	time.Sleep(2 * debounceDuration)
 
-	mockTM.AssertNumberOfCalls(t, "Run", 1)
+	mockTM.AssertNumberOfCalls(t, "RunContext", 1)
 
 	mockTM.ExpectedCalls = nil
-	mockTM.On("Run", "deploy").Return(nil)
+	onRun(mockTM, "deploy").Return(nil)
 
 	mockWatcher.events <- event1
 
 	time.Sleep(2 * debounceDuration)
-	mockTM.AssertNumberOfCalls(t, "Run", 2)
+	mockTM.AssertNumberOfCalls(t, "RunContext", 2)
 
 	close(mockWatcher.events)
 	close(mockWatcher.errors)
@@ -223,3 +264,528 @@ func TestWatcher_MultipleDebounceCycles(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestWatcher_Recursive(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{
+		"internal/foo",
+		"node_modules/left-pad",
+		".git/objects",
+		".groolp",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, dir), 0755))
+	}
+
+	mockWatcher := NewMockWatcher()
+	mockWatcher.On("Add", root).Return(nil)
+	mockWatcher.On("Add", filepath.Join(root, "internal")).Return(nil)
+	mockWatcher.On("Add", filepath.Join(root, "internal", "foo")).Return(nil)
+
+	w, err := NewWatcher(
+		new(MockTaskManager),
+		[]string{root},
+		"build",
+		500*time.Millisecond,
+		mockWatcher,
+	)
+	require.NoError(t, err)
+	mockWatcher.AssertExpectations(t)
+	mockWatcher.AssertNumberOfCalls(t, "Add", 3)
+
+	// Directories created later are added, removed ones dropped
+	newDir := filepath.Join(root, "internal", "bar", "baz")
+	require.NoError(t, os.MkdirAll(newDir, 0755))
+	mockWatcher.On("Add", filepath.Join(root, "internal", "bar")).Return(nil)
+	mockWatcher.On("Add", newDir).Return(nil)
+	w.handleDirEvent(fsnotify.Event{
+		Name: filepath.Join(root, "internal", "bar"),
+		Op:   fsnotify.Create,
+	})
+	require.True(t, w.watched[newDir])
+
+	mockWatcher.On("Remove", mock.Anything).Return(nil)
+	w.handleDirEvent(fsnotify.Event{
+		Name: filepath.Join(root, "internal"),
+		Op:   fsnotify.Remove,
+	})
+	require.Equal(t, map[string]bool{root: true}, w.watched)
+	mockWatcher.AssertNumberOfCalls(t, "Remove", 4)
+
+	require.True(t, w.isIgnored(filepath.Join(root, "node_modules", "x.js")))
+	require.False(t, w.isIgnored(filepath.Join(root, "internal", "x.go")))
+}
+
+func TestWatcher_NestedChange(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "internal", "foo"), 0755))
+
+	mockTM := new(MockTaskManager)
+	ran := make(chan bool, 1)
+	onRun(mockTM, "build").Return(nil).Run(func(mock.Arguments) {
+		ran <- true
+	})
+
+	w, err := NewWatcher(mockTM, []string{root}, "build", 50*time.Millisecond)
+	require.NoError(t, err)
+	go w.Start()
+	defer w.watcher.Close()
+
+	// A directory created after startup is watched as well
+	dir := filepath.Join(root, "internal", "foo", "bar")
+	require.NoError(t, os.Mkdir(dir, 0755))
+	<-ran
+
+	file := filepath.Join(dir, "bar.go")
+	require.NoError(t, os.WriteFile(file, []byte("package bar"), 0644))
+	select {
+	case <-ran:
+	case <-time.After(2 * time.Second):
+		t.Fatal("change in a nested directory did not trigger the task")
+	}
+}
+
+func TestWatcher_Exclude(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"src", "build/out"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, dir), 0755))
+	}
+
+	mockTM := new(MockTaskManager)
+	onRun(mockTM, "build").Return(nil)
+
+	mockWatcher := NewMockWatcher()
+	mockWatcher.On("Add", mock.Anything).Return(nil)
+	mockWatcher.On("Close").Return(nil)
+
+	w, err := NewMultiWatcher(
+		mockTM,
+		[]string{root},
+		[]Rule{{Task: "build"}},
+		50*time.Millisecond,
+		Options{Exclude: []string{filepath.Join(root, "build", "**")}},
+		mockWatcher,
+	)
+	require.NoError(t, err)
+	w.SetInclude([]string{filepath.Join(root, "**", "*.go")})
+
+	// Excluded directories are never added, not even temporarily
+	mockWatcher.AssertNotCalled(t, "Add", filepath.Join(root, "build"))
+	mockWatcher.AssertNotCalled(t, "Add", filepath.Join(root, "build", "out"))
+	mockWatcher.AssertCalled(t, "Add", filepath.Join(root, "src"))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.Start()
+	}()
+
+	// Excluded and non-matching files are dropped before the debounce
+	for _, name := range []string{
+		filepath.Join(root, "build", "out", "gen.go"),
+		filepath.Join(root, "src", ".main.go.swp"),
+		filepath.Join(root, "src", "README.md"),
+	} {
+		mockWatcher.events <- fsnotify.Event{Name: name, Op: fsnotify.Write}
+	}
+	time.Sleep(200 * time.Millisecond)
+	assertNotRan(t, mockTM, "build")
+
+	mockWatcher.events <- fsnotify.Event{
+		Name: filepath.Join(root, "src", "main.go"),
+		Op:   fsnotify.Write,
+	}
+	time.Sleep(200 * time.Millisecond)
+	mockTM.AssertNumberOfCalls(t, "RunContext", 1)
+
+	close(mockWatcher.events)
+	close(mockWatcher.errors)
+	wg.Wait()
+}
+
+func TestWatcher_ExcludeCreatedDirectories(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "src"), 0755))
+
+	mockTM := new(MockTaskManager)
+	onRun(mockTM, "build").Return(nil)
+
+	srcDir := filepath.Join(root, "src", "pkg")
+	added := make(chan bool, 1)
+	mockWatcher := NewMockWatcher()
+	mockWatcher.On("Add", srcDir).Return(nil).Run(func(mock.Arguments) {
+		added <- true
+	})
+	mockWatcher.On("Add", mock.Anything).Return(nil)
+	mockWatcher.On("Close").Return(nil)
+
+	w, err := NewMultiWatcher(
+		mockTM,
+		[]string{root},
+		[]Rule{{Task: "build"}},
+		50*time.Millisecond,
+		Options{Exclude: []string{filepath.Join(root, "build", "**")}},
+		mockWatcher,
+	)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.Start()
+	}()
+
+	// Excluded and ignored directories created after startup, e.g. by a
+	// rebuild, are not watched either
+	buildDir := filepath.Join(root, "build", "a", "b")
+	modulesDir := filepath.Join(root, "node_modules", "left-pad")
+	for _, dir := range []string{buildDir, modulesDir, srcDir} {
+		require.NoError(t, os.MkdirAll(dir, 0755))
+	}
+	for _, name := range []string{
+		filepath.Join(root, "build"),
+		filepath.Join(root, "node_modules"),
+		srcDir,
+	} {
+		mockWatcher.events <- fsnotify.Event{Name: name, Op: fsnotify.Create}
+	}
+
+	// Events are handled in order, so the others were dropped by now
+	select {
+	case <-added:
+	case <-time.After(2 * time.Second):
+		t.Fatal("created directory was not watched")
+	}
+	mockWatcher.AssertNotCalled(t, "Add", filepath.Join(root, "build"))
+	mockWatcher.AssertNotCalled(t, "Add", buildDir)
+	mockWatcher.AssertNotCalled(t, "Add", filepath.Join(root, "node_modules"))
+	mockWatcher.AssertNotCalled(t, "Add", modulesDir)
+
+	close(mockWatcher.events)
+	close(mockWatcher.errors)
+	wg.Wait()
+}
+
+func TestMultiWatcher(t *testing.T) {
+	mockTM := new(MockTaskManager)
+	onRun(mockTM, "build", "docs").Return(nil)
+	onRun(mockTM, "build", "lint").Return(nil)
+
+	mockWatcher := NewMockWatcher()
+	mockWatcher.On("Add", ".").Return(nil)
+	mockWatcher.On("Close").Return(nil)
+
+	w, err := NewMultiWatcher(
+		mockTM,
+		[]string{"."},
+		[]Rule{
+			{Task: "build", Patterns: []string{"**/*.go", "go.mod"}},
+			{Task: "docs", Patterns: []string{"docs/**"}},
+			{Task: "lint", Patterns: []string{"**/*.go", ".golangci.yml"}},
+		},
+		100*time.Millisecond,
+		Options{},
+		mockWatcher,
+	)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.Start()
+	}()
+
+	// Changes within the debounce duration are combined into one run of
+	// the matching tasks, each listed once
+	for _, name := range []string{
+		"go.mod",
+		"docs/index.md",
+		"go.mod",
+		"README.md",
+	} {
+		mockWatcher.events <- fsnotify.Event{Name: name, Op: fsnotify.Write}
+	}
+	time.Sleep(300 * time.Millisecond)
+	assertRan(t, mockTM, "build", "docs")
+	mockTM.AssertNumberOfCalls(t, "RunContext", 1)
+
+	mockWatcher.events <- fsnotify.Event{Name: "cli/main.go", Op: fsnotify.Write}
+	time.Sleep(300 * time.Millisecond)
+	assertRan(t, mockTM, "build", "lint")
+	mockTM.AssertNumberOfCalls(t, "RunContext", 2)
+
+	close(mockWatcher.events)
+	close(mockWatcher.errors)
+	wg.Wait()
+}
+
+func TestMultiWatcher_PatternRoots(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"src", "docs"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, dir), 0755))
+	}
+
+	mockWatcher := NewMockWatcher()
+	mockWatcher.On("Add", filepath.Join(root, "src")).Return(nil)
+	mockWatcher.On("Add", filepath.Join(root, "docs")).Return(nil)
+
+	_, err := NewMultiWatcher(
+		new(MockTaskManager),
+		nil,
+		[]Rule{
+			{
+				Task:     "build",
+				Patterns: []string{filepath.Join(root, "src", "**", "*.go")},
+			},
+			{
+				Task:     "docs",
+				Patterns: []string{filepath.Join(root, "docs", "*.md")},
+			},
+		},
+		100*time.Millisecond,
+		Options{},
+		mockWatcher,
+	)
+	require.NoError(t, err)
+	mockWatcher.AssertExpectations(t)
+}
+
+func TestWatcher_Service(t *testing.T) {
+	// The service runs until the watcher stops it
+	var starts, stops int
+	var mu sync.Mutex
+	mockTM := new(MockTaskManager)
+	onRun(mockTM, "lint").Return(nil)
+	mockTM.On(
+		"RunContext",
+		mock.Anything,
+		[]string{"serve"},
+		core.RunOptions{},
+	).Run(func(args mock.Arguments) {
+		mu.Lock()
+		starts++
+		mu.Unlock()
+		<-args.Get(0).(context.Context).Done()
+		mu.Lock()
+		stops++
+		mu.Unlock()
+	}).Return(context.Canceled)
+
+	mockWatcher := NewMockWatcher()
+	mockWatcher.On("Add", ".").Return(nil)
+	mockWatcher.On("Close").Return(nil)
+
+	w, err := NewMultiWatcher(
+		mockTM,
+		[]string{"."},
+		[]Rule{
+			{Task: "lint", Patterns: []string{"**/*.go"}},
+			{Task: "serve", Patterns: []string{"**/*.go"}, Service: true},
+		},
+		100*time.Millisecond,
+		Options{},
+		mockWatcher,
+	)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.Start()
+	}()
+
+	counts := func() (int, int) {
+		mu.Lock()
+		defer mu.Unlock()
+		return starts, stops
+	}
+
+	// The service is started along with the watcher and does not block
+	// the event loop
+	require.Eventually(t, func() bool {
+		s, _ := counts()
+		return s == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// A change runs the other tasks and restarts the service
+	mockWatcher.events <- fsnotify.Event{Name: "main.go", Op: fsnotify.Write}
+	require.Eventually(t, func() bool {
+		s, st := counts()
+		return s == 2 && st == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// Closing the watcher stops the service and waits for the run
+	close(mockWatcher.events)
+	close(mockWatcher.errors)
+	wg.Wait()
+	assertRan(t, mockTM, "lint")
+	s, st := counts()
+	require.Equal(t, 2, s)
+	require.Equal(t, 2, st)
+}
+
+func TestWatcher_OnChange(t *testing.T) {
+	for _, tc := range []struct {
+		policy    OnChange
+		runs      int
+		cancelled int
+	}{
+		// Both changes made during the first run are collapsed into one
+		// follow-up run
+		{OnChangeQueue, 2, 0},
+		// Each change cancels the run in progress and starts it again
+		{OnChangeRestart, 3, 2},
+		{OnChangeIgnore, 1, 0},
+	} {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			var mu sync.Mutex
+			var runs, cancelled int
+			release := make(chan struct{})
+
+			mockTM := new(MockTaskManager)
+			onRun(mockTM, "build").Return(nil).Run(func(args mock.Arguments) {
+				mu.Lock()
+				runs++
+				mu.Unlock()
+				select {
+				case <-args.Get(0).(context.Context).Done():
+					mu.Lock()
+					cancelled++
+					mu.Unlock()
+				case <-release:
+				}
+			})
+
+			mockWatcher := NewMockWatcher()
+			mockWatcher.On("Add", ".").Return(nil)
+			mockWatcher.On("Close").Return(nil)
+
+			w, err := NewWatcher(
+				mockTM,
+				[]string{"."},
+				"build",
+				50*time.Millisecond,
+				mockWatcher,
+			)
+			require.NoError(t, err)
+			w.SetOnChange(tc.policy)
+
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				w.Start()
+			}()
+
+			event := fsnotify.Event{Name: "main.go", Op: fsnotify.Write}
+			for i := 0; i < 3; i++ {
+				mockWatcher.events <- event
+				time.Sleep(150 * time.Millisecond)
+			}
+			close(release)
+			time.Sleep(150 * time.Millisecond)
+
+			mu.Lock()
+			require.Equal(t, tc.runs, runs)
+			require.Equal(t, tc.cancelled, cancelled)
+			mu.Unlock()
+
+			close(mockWatcher.events)
+			close(mockWatcher.errors)
+			wg.Wait()
+		})
+	}
+}
+
+func TestParseOnChange(t *testing.T) {
+	policy, err := ParseOnChange("restart")
+	require.NoError(t, err)
+	require.Equal(t, OnChangeRestart, policy)
+
+	_, err = ParseOnChange("later")
+	require.EqualError(
+		t,
+		err,
+		"unknown on-change policy 'later'; expected queue, restart or ignore",
+	)
+}
+
+func TestMultiWatcher_MissingPatternRoot(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "src"), 0755))
+
+	// A pattern for a directory that does not exist does not stop the
+	// other tasks from being watched
+	mockWatcher := NewMockWatcher()
+	mockWatcher.On("Add", filepath.Join(root, "src")).Return(nil)
+	_, err := NewMultiWatcher(
+		new(MockTaskManager),
+		nil,
+		[]Rule{
+			{
+				Task:     "build",
+				Patterns: []string{filepath.Join(root, "src", "*.go")},
+			},
+			{
+				Task:     "dev",
+				Patterns: []string{filepath.Join(root, "templates", "*")},
+			},
+		},
+		100*time.Millisecond,
+		Options{},
+		mockWatcher,
+	)
+	require.NoError(t, err)
+	mockWatcher.AssertExpectations(t)
+
+	_, err = NewMultiWatcher(
+		new(MockTaskManager),
+		nil,
+		[]Rule{{
+			Task:     "dev",
+			Patterns: []string{filepath.Join(root, "templates", "*")},
+		}},
+		100*time.Millisecond,
+		Options{},
+		NewMockWatcher(),
+	)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "none of the watched directories exist")
+}
+
+func TestMultiWatcher_IgnoreFiles(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"src", "vendor/lib", "target"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, dir), 0755))
+	}
+	require.NoError(t, os.WriteFile(
+		filepath.Join(root, ".gitignore"),
+		[]byte("vendor/\n/target\n"),
+		0644,
+	))
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(root))
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+
+	mockWatcher := NewMockWatcher()
+	mockWatcher.On("Add", mock.Anything).Return(nil)
+	_, err = NewMultiWatcher(
+		new(MockTaskManager),
+		[]string{"."},
+		[]Rule{{Task: "build"}},
+		100*time.Millisecond,
+		Options{IgnoreFiles: []string{".gitignore", ".groolpignore"}},
+		mockWatcher,
+	)
+	require.NoError(t, err)
+	mockWatcher.AssertCalled(t, "Add", "src")
+	mockWatcher.AssertNotCalled(t, "Add", "vendor")
+	mockWatcher.AssertNotCalled(t, "Add", filepath.Join("vendor", "lib"))
+	mockWatcher.AssertNotCalled(t, "Add", "target")
+}